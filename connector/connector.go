@@ -19,11 +19,13 @@
 package connector
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"syscall"
 
+	"github.com/lambdasoup/go-netlink/internal/random"
 	"github.com/lambdasoup/go-netlink/log"
 	"github.com/lambdasoup/go-netlink/netlink"
 )
@@ -33,28 +35,35 @@ const (
 	cnMsgHdrLen = 20
 )
 
-// From uapi/linux/connector.h
-const (
-	cnW1Idx = 3
-	cnW1Val = 1
-)
+// ResponseType tells how a received message relates to a sent request
+type ResponseType int
 
-// Response types
+// Response types. The receiver of a request answers it by echoing its seq.
+// A reply acknowledges the request with ack set to seq+1, any other ack
+// makes it an echo, e.g. the status messages of w1 which repeat the
+// request's ack.
 const (
-	ResponseTypeEcho = iota
+	// ResponseTypeEcho is a message with the request's seq but without
+	// acknowledging it
+	ResponseTypeEcho ResponseType = iota
+	// ResponseTypeReply acknowledges the request
 	ResponseTypeReply
+	// ResponseTypeUnrelated belongs to another request, CbID or process
 	ResponseTypeUnrelated
 )
 
-// CbID identifies a Connector subsystem
-type CbID struct {
-	idx uint32
-	val uint32
+func (t ResponseType) String() string {
+	switch t {
+	case ResponseTypeEcho:
+		return "echo"
+	case ResponseTypeReply:
+		return "reply"
+	case ResponseTypeUnrelated:
+		return "unrelated"
+	}
+	return fmt.Sprintf("ResponseType(%d)", int(t))
 }
 
-// W1 is the CbID of the 1-Wire subsystem
-var W1 = CbID{cnW1Idx, cnW1Val}
-
 // msg is a Connector message
 type msg struct {
 	id    CbID
@@ -65,59 +74,233 @@ type msg struct {
 	data  []byte
 }
 
+// Message is a Connector message. Flags and Ack are protocol specific,
+// w1 for instance leaves them zero in requests.
+type Message struct {
+	ID    CbID
+	Seq   uint32
+	Ack   uint32
+	Flags uint16
+	Data  []byte
+}
+
+func (m *msg) message() *Message {
+	return &Message{m.id, m.seq, m.ack, m.flags, m.data}
+}
+
+// number of datagrams drained at once from transports which receive in
+// batches, such as the replies to a w1 bulk read
+const receiveBatchLen = 16
+
 // Connector is a Linux Connector
 type Connector struct {
-	nls *netlink.Socket
+	t   netlink.Transport
 	id  CbID
 	seq uint32
+	// received but not yet returned payloads of a batch
+	pending [][]byte
 }
 
-// Open a new Connector
+// Open a new Connector on a Netlink socket
 func Open(id CbID) (*Connector, error) {
-	nls, err := netlink.Open()
+	nls, err := netlink.Open(syscall.NETLINK_CONNECTOR)
 	if err != nil {
 		return nil, err
 	}
-	// TODO generate random sequence nr
-	return &Connector{nls, id, 0xdead}, nil
+	return New(nls, id), nil
+}
+
+// New returns a Connector for the given CbID on top of the given transport.
+// Sequence numbers start at a random value, so that processes talking to
+// the same subsystem at once can tell their replies apart.
+func New(t netlink.Transport, id CbID) *Connector {
+	return &Connector{t: t, id: id, seq: nextSeq(random.Uint32())}
+}
+
+// nextSeq returns the sequence number following seq. The largest one is
+// skipped, its replies would carry ack 0 just like status messages.
+func nextSeq(seq uint32) uint32 {
+	seq++
+	if seq == math.MaxUint32 {
+		seq = 0
+	}
+	return seq
+}
+
+// ID returns the CbID this Connector is opened for
+func (c *Connector) ID() CbID {
+	return c.id
 }
 
 // Close the Connector
 func (c *Connector) Close() {
-	c.nls.Close()
+	c.t.Close()
+}
+
+// Filter returns a netlink.Filter which only accepts messages of the given CbID
+func Filter(id CbID) (netlink.Filter, error) {
+	return netlink.NewFilter(
+		netlink.Match{Offset: syscall.NLMSG_HDRLEN, Size: 4, Values: []uint32{id.idx}},
+		netlink.Match{Offset: syscall.NLMSG_HDRLEN + 4, Size: 4, Values: []uint32{id.val}},
+	)
+}
+
+// SetFilter attaches the given filter to this Connector's socket, so that
+// unwanted messages are dropped by the kernel
+func (c *Connector) SetFilter(f netlink.Filter) error {
+	s, ok := c.t.(interface {
+		SetFilter(netlink.Filter) error
+	})
+	if !ok {
+		return errors.New("transport does not support filters")
+	}
+	return s.SetFilter(f)
+}
+
+// Join subscribes this Connector to the multicast group of its CbID, so
+// that it also receives the subsystem's broadcasts
+func (c *Connector) Join() error {
+	s, ok := c.t.(interface {
+		JoinGroup(uint32) error
+	})
+	if !ok {
+		return errors.New("transport does not support multicast groups")
+	}
+	return s.JoinGroup(c.id.idx)
 }
 
 func (c *Connector) send(m *msg) error {
-	c.seq = c.seq + 1
+	bs, err := c.marshal(m)
+	if err != nil {
+		return err
+	}
+	return c.t.Send(bs)
+}
+
+// marshal returns the wire format of m, which takes the current sequence
+// number
+func (c *Connector) marshal(m *msg) ([]byte, error) {
+	c.seq = nextSeq(c.seq)
 
 	log.Printf("\t\tCN SEND: %v", m)
 
-	return c.nls.Send(m.bytes())
+	return m.MarshalBinary()
 }
 
 // Receive data on this Connector
-func (c *Connector) Receive(id *MsgID) (body []byte, rtype int, err error) {
-	data, err := c.nls.Receive()
+func (c *Connector) Receive(id *MsgID) (body []byte, rtype ResponseType, err error) {
+	m, rtype, err := c.ReceiveResponse(id)
 	if err != nil {
 		return
 	}
+	return m.Data, rtype, nil
+}
+
+// ReceiveResponse returns the next message on this Connector along with
+// how it relates to the request of the given MsgID
+func (c *Connector) ReceiveResponse(id *MsgID) (*Message, ResponseType, error) {
+	data, err := c.receive()
+	if err != nil {
+		return nil, ResponseTypeUnrelated, err
+	}
 	m, err := parseConnectorMsg(data)
 	if err != nil {
-		return
+		return nil, ResponseTypeUnrelated, err
+	}
+
+	log.Printf("\t\tCN RECV: %v", m)
+
+	return m.message(), id.responseType(m), nil
+}
+
+// responseType tells how m relates to the request of this MsgID
+func (id *MsgID) responseType(m *msg) ResponseType {
+	switch {
+	case m.id != id.cbID || m.seq != id.seq:
+		return ResponseTypeUnrelated
+	case m.ack == id.seq+1:
+		return ResponseTypeReply
 	}
-	body = m.data
+	return ResponseTypeEcho
+}
 
-	if m.ack == id.seq+1 {
-		rtype = ResponseTypeReply
-	} else if m.seq == id.seq {
-		rtype = ResponseTypeEcho
-	} else {
-		rtype = ResponseTypeUnrelated
+// ReceiveMessage returns the next message of this Connector's CbID, for
+// serving requests of the kernel. Messages of other CbIDs are skipped.
+func (c *Connector) ReceiveMessage() (*Message, error) {
+	for {
+		data, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseConnectorMsg(data)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("\t\tCN RECV: %v", m)
+		if m.id == c.id {
+			return m.message(), nil
+		}
 	}
+}
 
-	log.Printf("\t\tCN RECV: %v", m)
+// Serve calls fn for each message of this Connector's CbID until receiving
+// or fn fails, for daemons answering requests of the kernel. Malformed
+// datagrams are logged and skipped. Serve returns nil once the transport
+// has no more messages, such as a finished replay.
+func (c *Connector) Serve(fn func(m *Message) error) error {
+	for {
+		m, err := c.ReceiveMessage()
+		if err == io.EOF {
+			return nil
+		}
+		var perr *netlink.ParseError
+		if errors.As(err, &perr) {
+			log.Printf("\t\tCN SKIP: %v", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = fn(m)
+		if err != nil {
+			return err
+		}
+	}
+}
 
-	return
+// receive returns the next payload of the transport. Transports which
+// receive in batches, like netlink.Socket, are drained with one call for
+// all datagrams already queued.
+func (c *Connector) receive() ([]byte, error) {
+	if len(c.pending) == 0 {
+		b, ok := c.t.(interface {
+			ReceiveBatch(int) ([][]byte, error)
+		})
+		if !ok {
+			return c.t.Receive()
+		}
+		payloads, err := b.ReceiveBatch(receiveBatchLen)
+		if err != nil {
+			return nil, err
+		}
+		c.pending = payloads
+	}
+	data := c.pending[0]
+	c.pending = c.pending[1:]
+	return data, nil
+}
+
+// Reply answers the given message with data, echoing its sequence number
+func (c *Connector) Reply(to *Message, data []byte) error {
+	m := &msg{c.id, to.Seq, to.Seq + 1, uint16(len(data)), 0, data}
+	log.Printf("\t\tCN REPLY: %v", m)
+
+	bs, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return c.t.Send(bs)
 }
 
 func (m *msg) String() string {
@@ -135,7 +318,7 @@ func (c *Connector) Request(req []byte) ([]byte, error) {
 		return nil, err
 	}
 	if rtype != ResponseTypeReply {
-		return nil, fmt.Errorf("unexpected response type %d", rtype)
+		return nil, fmt.Errorf("unexpected response type %v", rtype)
 	}
 
 	return body, nil
@@ -143,55 +326,139 @@ func (c *Connector) Request(req []byte) ([]byte, error) {
 
 // MsgID identifies messages
 type MsgID struct {
-	seq uint32
+	cbID CbID
+	seq  uint32
+}
+
+// Seq returns the sequence number the request was sent with
+func (id *MsgID) Seq() uint32 {
+	return id.seq
 }
 
 // Send data on this Connector
 func (c *Connector) Send(req []byte) (*MsgID, error) {
-	// TODO remove magic numbers
-	seq := c.seq
-	m := &msg{c.id, seq, 0, uint16(len(req)), 0, req}
-	return &MsgID{seq}, c.send(m)
+	return c.SendMessage(&Message{Data: req})
 }
 
-func parseConnectorMsg(bs []byte) (*msg, error) {
-	m := &msg{}
-	buf := bytes.NewBuffer(bs)
-
-	err := error(nil)
-	// TODO LE vs BE?
-	err = binary.Read(buf, binary.LittleEndian, &m.id.idx)
-	err = binary.Read(buf, binary.LittleEndian, &m.id.val)
-	err = binary.Read(buf, binary.LittleEndian, &m.seq)
-	err = binary.Read(buf, binary.LittleEndian, &m.ack)
-	err = binary.Read(buf, binary.LittleEndian, &m.len)
-	err = binary.Read(buf, binary.LittleEndian, &m.flags)
+// SendMessage sends the Ack, Flags and Data of m on this Connector. Its ID
+// and Seq are set by the Connector.
+func (c *Connector) SendMessage(m *Message) (*MsgID, error) {
+	m.ID = c.id
+	m.Seq = c.seq
+	cm := &msg{m.ID, m.Seq, m.Ack, uint16(len(m.Data)), m.Flags, m.Data}
+	return &MsgID{m.ID, m.Seq}, c.send(cm)
+}
 
-	m.data = make([]byte, m.len)
+// SendMessages sends each of ms like SendMessage, and returns their MsgIDs.
+// Transports which send in batches, such as netlink.Socket, send them all
+// with one call.
+func (c *Connector) SendMessages(ms []*Message) ([]*MsgID, error) {
+	b, ok := c.t.(interface {
+		Queue(msgType uint16, flags uint16, data []byte)
+		Flush() error
+	})
+
+	ids := make([]*MsgID, len(ms))
+	for i, m := range ms {
+		m.ID = c.id
+		m.Seq = c.seq
+		cm := &msg{m.ID, m.Seq, m.Ack, uint16(len(m.Data)), m.Flags, m.Data}
+		ids[i] = &MsgID{m.ID, m.Seq}
+		if !ok {
+			if err := c.send(cm); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		bs, err := c.marshal(cm)
+		if err != nil {
+			return nil, err
+		}
+		b.Queue(syscall.NLMSG_DONE, 0, bs)
+	}
+	if ok {
+		if err := b.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
 
-	n, err := buf.Read(m.data)
+// RewriteSeq is a netlink.Replayer Rewrite for Connector sessions. It maps
+// the recorded sequence number to the sent one, in the recorded request as
+// well as in the replies' seq and ack fields.
+func RewriteSeq(sent, recorded []byte) func([]byte) []byte {
+	s, err := parseConnectorMsg(sent)
 	if err != nil {
-		return nil, err
+		return nil
+	}
+	r, err := parseConnectorMsg(recorded)
+	if err != nil || r.seq == s.seq {
+		return nil
 	}
 
-	if n != int(m.len) {
-		return nil, errors.New("buffer size mismatch")
+	return func(bs []byte) []byte {
+		if len(bs) < cnMsgHdrLen {
+			return bs
+		}
+		bs = append([]byte(nil), bs...)
+		if netlink.NativeEndian.Uint32(bs[8:]) == r.seq {
+			netlink.NativeEndian.PutUint32(bs[8:], s.seq)
+		}
+		if netlink.NativeEndian.Uint32(bs[12:]) == r.seq+1 {
+			netlink.NativeEndian.PutUint32(bs[12:], s.seq+1)
+		}
+		return bs
 	}
+}
 
+func parseConnectorMsg(bs []byte) (*msg, error) {
+	m := &msg{}
+	err := m.UnmarshalBinary(bs)
+	if err != nil {
+		return nil, err
+	}
 	return m, nil
 }
 
-func (m *msg) bytes() []byte {
-	buf := new(bytes.Buffer)
-
-	binary.Write(buf, binary.LittleEndian, m.id.idx)
-	binary.Write(buf, binary.LittleEndian, m.id.val)
-	binary.Write(buf, binary.LittleEndian, m.seq)
-	binary.Write(buf, binary.LittleEndian, m.ack)
-	binary.Write(buf, binary.LittleEndian, uint16(len(m.data)))
-	binary.Write(buf, binary.LittleEndian, m.flags)
+// UnmarshalBinary reads a message from the start of bs. The message's data
+// refers to bs and is not copied.
+func (m *msg) UnmarshalBinary(bs []byte) error {
+	if len(bs) < cnMsgHdrLen {
+		return &netlink.ParseError{Layer: "connector", Err: netlink.ErrShortMessage, Want: cnMsgHdrLen, Have: len(bs)}
+	}
+	m.id.idx = netlink.NativeEndian.Uint32(bs[0:])
+	m.id.val = netlink.NativeEndian.Uint32(bs[4:])
+	m.seq = netlink.NativeEndian.Uint32(bs[8:])
+	m.ack = netlink.NativeEndian.Uint32(bs[12:])
+	m.len = netlink.NativeEndian.Uint16(bs[16:])
+	m.flags = netlink.NativeEndian.Uint16(bs[18:])
+
+	if cnMsgHdrLen+int(m.len) > len(bs) {
+		return &netlink.ParseError{Layer: "connector", Err: netlink.ErrShortMessage, Want: cnMsgHdrLen + int(m.len), Have: len(bs)}
+	}
+	m.data = bs[cnMsgHdrLen : cnMsgHdrLen+int(m.len)]
+	return nil
+}
 
-	buf.Write(m.data)
+// AppendBinary appends the wire format of m to b. The length is taken from
+// the data.
+func (m *msg) AppendBinary(b []byte) ([]byte, error) {
+	if len(m.data) > math.MaxUint16 {
+		return b, fmt.Errorf("connector: data of %d bytes exceeds the maximum of %d", len(m.data), math.MaxUint16)
+	}
+	n := len(b)
+	b = append(b, make([]byte, cnMsgHdrLen)...)
+	netlink.NativeEndian.PutUint32(b[n:], m.id.idx)
+	netlink.NativeEndian.PutUint32(b[n+4:], m.id.val)
+	netlink.NativeEndian.PutUint32(b[n+8:], m.seq)
+	netlink.NativeEndian.PutUint32(b[n+12:], m.ack)
+	netlink.NativeEndian.PutUint16(b[n+16:], uint16(len(m.data)))
+	netlink.NativeEndian.PutUint16(b[n+18:], m.flags)
+	return append(b, m.data...), nil
+}
 
-	return buf.Bytes()
+// MarshalBinary returns the wire format of m
+func (m *msg) MarshalBinary() ([]byte, error) {
+	return m.AppendBinary(make([]byte, 0, cnMsgHdrLen+len(m.data)))
 }
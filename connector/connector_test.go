@@ -19,16 +19,24 @@ package connector
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
 	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+	"github.com/lambdasoup/go-netlink/netlink"
 )
 
 const (
-	cnNetlinkUsers = 11
-	cnTestIdx      = cnNetlinkUsers + 3
-	cnTestVal      = 0x456
+	cnTestIdx = NetlinkUsers + 3
+	cnTestVal = 0x456
 )
 
 func TestParseConnectorMessage(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
 	var bs []byte
 
 	// CB_IDX, CB_VAL
@@ -60,8 +68,277 @@ func TestParseConnectorMessage(t *testing.T) {
 	assert(t, bytes.Equal(msg.data, payload))
 }
 
+func TestByteOrders(t *testing.T) {
+	for _, order := range nltest.ByteOrders {
+		t.Run(order.String(), func(t *testing.T) {
+			nltest.UseByteOrder(t, order)
+
+			m := &msg{CbID{cnTestIdx, cnTestVal}, 12345, 12346, 3, 1, []byte{1, 2, 3}}
+			bs, err := m.MarshalBinary()
+			assert(t, err == nil)
+			assert(t, order.Uint32(bs[0:]) == cnTestIdx)
+			assert(t, order.Uint32(bs[4:]) == cnTestVal)
+			assert(t, order.Uint32(bs[8:]) == 12345)
+			assert(t, order.Uint16(bs[16:]) == 3)
+
+			parsed, err := parseConnectorMsg(bs)
+			assert(t, err == nil)
+			assert(t, parsed.id == m.id)
+			assert(t, parsed.seq == m.seq)
+			assert(t, parsed.ack == m.ack)
+			assert(t, parsed.flags == m.flags)
+			assert(t, bytes.Equal(parsed.data, m.data))
+		})
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	bs, err := (&msg{W1, 1, 0, 0, 0, []byte{1, 2, 3}}).MarshalBinary()
+	assert(t, err == nil)
+
+	m := &msg{}
+	assert(t, m.UnmarshalBinary(bs) == nil)
+	assert(t, errors.Is(m.UnmarshalBinary(bs[:cnMsgHdrLen-1]), netlink.ErrShortMessage))
+	assert(t, errors.Is(m.UnmarshalBinary(bs[:len(bs)-1]), netlink.ErrShortMessage))
+
+	_, err = (&msg{data: make([]byte, 1<<16)}).MarshalBinary()
+	assert(t, err != nil)
+}
+
+func TestResponseType(t *testing.T) {
+	for _, seq := range []uint32{12345, math.MaxUint32 - 1, 0} {
+		id := &MsgID{W1, seq}
+
+		assert(t, id.responseType(&msg{id: W1, seq: seq, ack: seq + 1}) == ResponseTypeReply)
+		assert(t, id.responseType(&msg{id: W1, seq: seq, ack: 0}) == ResponseTypeEcho)
+		// replies to another process or another subsystem
+		assert(t, id.responseType(&msg{id: W1, seq: seq + 7, ack: seq + 1}) == ResponseTypeUnrelated)
+		assert(t, id.responseType(&msg{id: Proc, seq: seq, ack: seq + 1}) == ResponseTypeUnrelated)
+	}
+
+	// the sequence number whose ack would wrap to 0 is never used
+	assert(t, nextSeq(math.MaxUint32-1) == 0)
+	assert(t, nextSeq(math.MaxUint32) == 0)
+	assert(t, nextSeq(0) == 1)
+}
+
+// peer is a netlink.Transport which records sent datagrams and answers
+// each of them with an echo and a reply carrying flags
+type peer struct {
+	sent  [][]byte
+	queue [][]byte
+}
+
+func (p *peer) Send(data []byte) error {
+	p.sent = append(p.sent, data)
+	m, err := parseConnectorMsg(data)
+	if err != nil {
+		return err
+	}
+	echo, _ := (&msg{m.id, m.seq, m.ack, 0, 0, nil}).MarshalBinary()
+	reply, _ := (&msg{m.id, m.seq, m.seq + 1, 0, 5, []byte{1}}).MarshalBinary()
+	p.queue = append(p.queue, echo, reply)
+	return nil
+}
+
+func (p *peer) Receive() ([]byte, error) {
+	if len(p.queue) == 0 {
+		return nil, io.EOF
+	}
+	data := p.queue[0]
+	p.queue = p.queue[1:]
+	return data, nil
+}
+
+func (p *peer) Close() {}
+
+func TestSendMessage(t *testing.T) {
+	p := &peer{}
+	c := New(p, W1)
+
+	m := &Message{Ack: 77, Flags: 2, Data: []byte{9}}
+	id, err := c.SendMessage(m)
+	assert(t, err == nil)
+	assert(t, m.ID == W1 && m.Seq == id.Seq())
+
+	sent, err := parseConnectorMsg(p.sent[0])
+	assert(t, err == nil)
+	assert(t, sent.seq == id.Seq() && sent.ack == 77 && sent.flags == 2)
+
+	echo, rtype, err := c.ReceiveResponse(id)
+	assert(t, err == nil && rtype == ResponseTypeEcho && echo.Ack == 77)
+	reply, rtype, err := c.ReceiveResponse(id)
+	assert(t, err == nil && rtype == ResponseTypeReply)
+	assert(t, reply.Flags == 5 && bytes.Equal(reply.Data, []byte{1}))
+
+	// the next request does not match the old responses
+	id2, err := c.Send([]byte{8})
+	assert(t, err == nil && id2.Seq() != id.Seq())
+	assert(t, id2.responseType(sent) == ResponseTypeUnrelated)
+
+	assert(t, ResponseTypeReply.String() == "reply" && ResponseType(7).String() == "ResponseType(7)")
+}
+
+// batchPeer is a peer which hands out all queued datagrams at once, and
+// takes requests in batches, too
+type batchPeer struct {
+	peer
+	batches int
+	queued  [][]byte
+	flushes int
+}
+
+func (p *batchPeer) Queue(msgType uint16, flags uint16, data []byte) {
+	p.queued = append(p.queued, data)
+}
+
+func (p *batchPeer) Flush() error {
+	p.flushes++
+	for _, data := range p.queued {
+		if err := p.Send(data); err != nil {
+			return err
+		}
+	}
+	p.queued = nil
+	return nil
+}
+
+func (p *batchPeer) ReceiveBatch(max int) ([][]byte, error) {
+	p.batches++
+	if len(p.queue) == 0 {
+		return nil, io.EOF
+	}
+	n := len(p.queue)
+	if n > max {
+		n = max
+	}
+	batch := p.queue[:n]
+	p.queue = p.queue[n:]
+	return batch, nil
+}
+
+func TestReceiveBatch(t *testing.T) {
+	p := &batchPeer{}
+	c := New(p, W1)
+
+	id, err := c.Send([]byte{9})
+	assert(t, err == nil)
+	_, rtype, err := c.Receive(id)
+	assert(t, err == nil && rtype == ResponseTypeEcho)
+	_, rtype, err = c.Receive(id)
+	assert(t, err == nil && rtype == ResponseTypeReply)
+
+	// echo and reply were drained together
+	assert(t, p.batches == 1)
+}
+
+func TestSendMessages(t *testing.T) {
+	for _, tr := range []netlink.Transport{&peer{}, &batchPeer{}} {
+		c := New(tr, W1)
+
+		ms := []*Message{{Data: []byte{1}}, {Data: []byte{2}}, {Data: []byte{3}}}
+		ids, err := c.SendMessages(ms)
+		assert(t, err == nil && len(ids) == len(ms))
+		for i, id := range ids {
+			assert(t, ms[i].Seq == id.Seq())
+			assert(t, i == 0 || id.Seq() != ids[i-1].Seq())
+
+			_, rtype, err := c.Receive(id)
+			assert(t, err == nil && rtype == ResponseTypeEcho)
+			_, rtype, err = c.Receive(id)
+			assert(t, err == nil && rtype == ResponseTypeReply)
+		}
+		if b, ok := tr.(*batchPeer); ok {
+			assert(t, b.flushes == 1 && len(b.sent) == len(ms))
+		}
+	}
+}
+
+func TestRewriteSeq(t *testing.T) {
+	recorded, _ := (&msg{W1, 0xdead, 0, 0, 0, []byte{1}}).MarshalBinary()
+	sent, _ := (&msg{W1, 4711, 0, 0, 0, []byte{1}}).MarshalBinary()
+	reply, _ := (&msg{W1, 0xdead, 0xdead + 1, 0, 0, []byte{2}}).MarshalBinary()
+	status, _ := (&msg{W1, 0xdead, 0, 0, 0, []byte{3}}).MarshalBinary()
+
+	rewrite := RewriteSeq(sent, recorded)
+	assert(t, rewrite != nil)
+	assert(t, bytes.Equal(rewrite(recorded), sent))
+
+	m, err := parseConnectorMsg(rewrite(reply))
+	assert(t, err == nil && m.seq == 4711 && m.ack == 4712)
+	m, err = parseConnectorMsg(rewrite(status))
+	assert(t, err == nil && m.seq == 4711 && m.ack == 0)
+
+	// the capture itself stays untouched
+	m, _ = parseConnectorMsg(reply)
+	assert(t, m.seq == 0xdead)
+
+	assert(t, RewriteSeq(recorded, recorded) == nil)
+	assert(t, RewriteSeq([]byte{1}, recorded) == nil)
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	bs, _ := (&msg{W1, 1, 2, 3, 0, []byte{1, 2, 3}}).MarshalBinary()
+	f.Add(bs)
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		m := &msg{}
+		if m.UnmarshalBinary(bs) != nil {
+			return
+		}
+		out, err := m.AppendBinary(nil)
+		if err != nil || !bytes.Equal(out, bs[:cnMsgHdrLen+int(m.len)]) {
+			t.Errorf("round trip of %x gave %x, %v", bs, out, err)
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	bs, _ := (&msg{W1, 1, 2, 3, 0, []byte{1, 2, 3}}).MarshalBinary()
+	f.Add(bs)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decode(&netlink.Node{}, 0, data)
+	})
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	m := &msg{W1, 1, 0, 0, 0, make([]byte, 64)}
+	buf := make([]byte, 0, 128)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = m.AppendBinary(buf[:0])
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	bs, _ := (&msg{W1, 1, 0, 0, 0, make([]byte, 64)}).MarshalBinary()
+	m := &msg{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m.UnmarshalBinary(bs)
+	}
+}
+
 func assert(t *testing.T, assertion bool) {
 	if !assertion {
 		t.Fatalf("assertion failed")
 	}
 }
+
+func TestServe(t *testing.T) {
+	k := &nltest.Kernel{Requests: [][]byte{
+		// truncated
+		nltest.CnMsg(W1, 1, []byte{1})[:12],
+		nltest.CnMsg(W1, 2, []byte{2}),
+	}}
+	var seqs []uint32
+	err := New(k, W1).Serve(func(m *Message) error {
+		seqs = append(seqs, m.Seq)
+		return nil
+	})
+	assert(t, err == nil && len(seqs) == 1 && seqs[0] == 2)
+
+	failure := errors.New("failure")
+	k.Requests = [][]byte{nltest.CnMsg(W1, 3, nil)}
+	err = New(k, W1).Serve(func(m *Message) error { return failure })
+	assert(t, err == failure)
+}
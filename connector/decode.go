@@ -0,0 +1,77 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package connector
+
+import (
+	"syscall"
+
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// Decoder decodes the payload of a Connector message into n. Decoders must
+// not trust the payload to be well formed.
+type Decoder func(n *netlink.Node, data []byte)
+
+var decoders = map[CbID]Decoder{}
+
+// RegisterDecoder installs the Decoder for messages of the given CbID
+func RegisterDecoder(id CbID, d Decoder) {
+	decoders[id] = d
+}
+
+func init() {
+	netlink.RegisterDecoder(syscall.NETLINK_CONNECTOR, decode)
+}
+
+// decode renders the Connector messages of a Netlink payload. The kernel
+// may bundle several of them into one Netlink message.
+func decode(n *netlink.Node, msgType uint16, payload []byte) {
+	for len(payload) > 0 {
+		if len(payload) < cnMsgHdrLen {
+			n.AddHex("truncated", payload)
+			return
+		}
+
+		id := CbID{netlink.NativeEndian.Uint32(payload[0:]), netlink.NativeEndian.Uint32(payload[4:])}
+		l := int(netlink.NativeEndian.Uint16(payload[16:]))
+
+		name, ok := Name(id)
+		if !ok {
+			name = "unknown"
+		}
+		c := n.Add("connector", "%s (%d:%d)", name, id.idx, id.val)
+		c.Add("seq", "%d", netlink.NativeEndian.Uint32(payload[8:]))
+		c.Add("ack", "%d", netlink.NativeEndian.Uint32(payload[12:]))
+		c.Add("len", "%d", l)
+		c.Add("flags", "%#x", netlink.NativeEndian.Uint16(payload[18:]))
+
+		if cnMsgHdrLen+l > len(payload) {
+			c.AddHex("invalid length", payload[cnMsgHdrLen:])
+			return
+		}
+		data := payload[cnMsgHdrLen : cnMsgHdrLen+l]
+
+		if d, ok := decoders[id]; ok {
+			d(c, data)
+		} else if len(data) > 0 {
+			c.AddHex("data", data)
+		}
+
+		payload = payload[cnMsgHdrLen+l:]
+	}
+}
@@ -0,0 +1,53 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package dmulog
+
+import (
+	"syscall"
+
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+func init() {
+	connector.RegisterDecoder(connector.DM, decode)
+}
+
+// decode renders a dm-log-userspace request or reply
+func decode(n *netlink.Node, data []byte) {
+	r := &Request{}
+	err := r.UnmarshalBinary(data)
+	if err != nil {
+		n.AddHex("invalid request", data)
+		return
+	}
+
+	m := n.Add("dmulog", "%v", r.Type)
+	m.Add("uuid", "%q", r.UUID)
+	m.Add("luid", "%d", r.LUID)
+	m.Add("version", "%d", r.Version)
+	if r.Error == 0 {
+		m.Add("error", "0")
+	} else {
+		m.Add("error", "%d (%v)", r.Error, syscall.Errno(-r.Error))
+	}
+	m.Add("seq", "%d", r.Seq)
+	if len(r.Data) > 0 {
+		m.AddHex("data", r.Data)
+	}
+}
@@ -0,0 +1,200 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package dmulog implements the userspace side of the device-mapper
+// userspace dirty log (dm-log-userspace) over Connector
+package dmulog
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// RequestType is the kind of a dm-log-userspace request
+type RequestType uint32
+
+// From uapi/linux/dm-log-userspace.h
+const (
+	Ctr RequestType = iota + 1
+	Dtr
+	Presuspend
+	Postsuspend
+	Resume
+	GetRegionSize
+	IsClean
+	InSync
+	Flush
+	MarkRegion
+	ClearRegion
+	GetResyncWork
+	SetRegionSync
+	GetSyncCount
+	StatusInfo
+	StatusTable
+	IsRemoteRecovering
+)
+
+var requestTypeNames = []string{
+	"DM_ULOG_CTR",
+	"DM_ULOG_DTR",
+	"DM_ULOG_PRESUSPEND",
+	"DM_ULOG_POSTSUSPEND",
+	"DM_ULOG_RESUME",
+	"DM_ULOG_GET_REGION_SIZE",
+	"DM_ULOG_IS_CLEAN",
+	"DM_ULOG_IN_SYNC",
+	"DM_ULOG_FLUSH",
+	"DM_ULOG_MARK_REGION",
+	"DM_ULOG_CLEAR_REGION",
+	"DM_ULOG_GET_RESYNC_WORK",
+	"DM_ULOG_SET_REGION_SYNC",
+	"DM_ULOG_GET_SYNC_COUNT",
+	"DM_ULOG_STATUS_INFO",
+	"DM_ULOG_STATUS_TABLE",
+	"DM_ULOG_IS_REMOTE_RECOVERING",
+}
+
+func (t RequestType) String() string {
+	if t >= Ctr && int(t) <= len(requestTypeNames) {
+		return requestTypeNames[t-1]
+	}
+	return fmt.Sprintf("DM_ULOG_%d", uint32(t))
+}
+
+// From uapi/linux/dm-log-userspace.h
+const (
+	// Version is the protocol version this package speaks
+	Version = 3
+
+	uuidLen        = 129
+	requestHdrLen  = 160
+	requestTypeMsk = 0xff
+)
+
+// Request is a dm-log-userspace request of the kernel, struct
+// dm_ulog_request
+type Request struct {
+	// LUID tells apart logs of the same device
+	LUID uint64
+	// UUID is the mapped device's uuid
+	UUID    string
+	Version uint32
+	Error   int32
+	Seq     uint32
+	Type    RequestType
+	Data    []byte
+}
+
+func (r *Request) String() string {
+	return fmt.Sprintf("DMULogRequest{%v, uuid %q, luid %d, seq %d, data %d}", r.Type, r.UUID, r.LUID, r.Seq, len(r.Data))
+}
+
+// UnmarshalBinary reads a request from bs. The data refers to bs and is
+// not copied.
+func (r *Request) UnmarshalBinary(bs []byte) error {
+	if len(bs) < requestHdrLen {
+		return &netlink.ParseError{Layer: "dmulog", Err: netlink.ErrShortMessage, Want: requestHdrLen, Have: len(bs)}
+	}
+	r.LUID = netlink.NativeEndian.Uint64(bs[0:])
+	uuid := bs[8 : 8+uuidLen]
+	if i := bytes.IndexByte(uuid, 0); i >= 0 {
+		uuid = uuid[:i]
+	}
+	r.UUID = string(uuid)
+	r.Version = netlink.NativeEndian.Uint32(bs[140:])
+	r.Error = int32(netlink.NativeEndian.Uint32(bs[144:]))
+	r.Seq = netlink.NativeEndian.Uint32(bs[148:])
+	r.Type = RequestType(netlink.NativeEndian.Uint32(bs[152:]) & requestTypeMsk)
+	size := netlink.NativeEndian.Uint32(bs[156:])
+
+	if uint64(size) > uint64(len(bs)-requestHdrLen) {
+		return &netlink.ParseError{Layer: "dmulog", Err: netlink.ErrShortMessage, Want: requestHdrLen + int(size), Have: len(bs)}
+	}
+	r.Data = bs[requestHdrLen : requestHdrLen+int(size)]
+	return nil
+}
+
+// AppendBinary appends the wire format of r to b
+func (r *Request) AppendBinary(b []byte) ([]byte, error) {
+	if len(r.UUID) >= uuidLen {
+		return b, fmt.Errorf("dmulog: uuid of %d bytes exceeds the maximum of %d", len(r.UUID), uuidLen-1)
+	}
+	n := len(b)
+	b = append(b, make([]byte, requestHdrLen)...)
+	netlink.NativeEndian.PutUint64(b[n:], r.LUID)
+	copy(b[n+8:], r.UUID)
+	netlink.NativeEndian.PutUint32(b[n+140:], r.Version)
+	netlink.NativeEndian.PutUint32(b[n+144:], uint32(r.Error))
+	netlink.NativeEndian.PutUint32(b[n+148:], r.Seq)
+	netlink.NativeEndian.PutUint32(b[n+152:], uint32(r.Type))
+	netlink.NativeEndian.PutUint32(b[n+156:], uint32(len(r.Data)))
+	return append(b, r.Data...), nil
+}
+
+// MarshalBinary returns the wire format of r
+func (r *Request) MarshalBinary() ([]byte, error) {
+	return r.AppendBinary(make([]byte, 0, requestHdrLen+len(r.Data)))
+}
+
+// Regions returns the region numbers a request carries, as sent with
+// IsClean, InSync, MarkRegion and ClearRegion
+func (r *Request) Regions() ([]uint64, error) {
+	if len(r.Data)%8 != 0 {
+		return nil, &netlink.ParseError{Layer: "dmulog", Err: netlink.ErrInvalidLength, Want: (len(r.Data) + 7) &^ 7, Have: len(r.Data)}
+	}
+	regions := make([]uint64, len(r.Data)/8)
+	for i := range regions {
+		regions[i] = netlink.NativeEndian.Uint64(r.Data[8*i:])
+	}
+	return regions, nil
+}
+
+// Uint64 encodes a region number, size or count as reply data
+func Uint64(v uint64) []byte {
+	bs := make([]byte, 8)
+	netlink.NativeEndian.PutUint64(bs, v)
+	return bs
+}
+
+// Handler serves dm-log-userspace requests. It returns the reply data, or
+// an error which the kernel receives as errno. Errors other than a
+// syscall.Errno are reported as EIO.
+type Handler interface {
+	ServeLog(req *Request) ([]byte, error)
+}
+
+// HandlerFunc adapts a function to the Handler interface
+type HandlerFunc func(req *Request) ([]byte, error)
+
+// ServeLog calls f(req)
+func (f HandlerFunc) ServeLog(req *Request) ([]byte, error) {
+	return f(req)
+}
+
+// errno returns the negative errno the kernel expects for err
+func errno(err error) int32 {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(syscall.Errno); ok {
+		return -int32(e)
+	}
+	return -int32(syscall.EIO)
+}
@@ -0,0 +1,82 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package dmulog
+
+import (
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/log"
+)
+
+// Server answers the kernel's dm-log-userspace requests with a Handler
+type Server struct {
+	c *connector.Connector
+	h Handler
+}
+
+// NewServer returns a Server for the requests received on c, which must be
+// opened for connector.DM and have joined its group
+func NewServer(c *connector.Connector, h Handler) *Server {
+	return &Server{c, h}
+}
+
+// ListenAndServe opens a Connector for the dm-log-userspace requests of the
+// kernel and serves them with h. Handling them requires CAP_SYS_ADMIN.
+func ListenAndServe(h Handler) error {
+	c, err := connector.Open(connector.DM)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.Join()
+	if err != nil {
+		return err
+	}
+	return NewServer(c, h).Serve()
+}
+
+// Serve answers requests one by one until receiving fails. It returns nil
+// once the transport has no more requests, such as a finished replay.
+func (s *Server) Serve() error {
+	return s.c.Serve(s.serve)
+}
+
+// serve answers the request in m
+func (s *Server) serve(m *connector.Message) error {
+	req := &Request{}
+	err := req.UnmarshalBinary(m.Data)
+	if err != nil {
+		// without a sequence number there is nobody to answer
+		log.Printf("DMULOG SKIP: %v", err)
+		return nil
+	}
+	log.Printf("DMULOG REQUEST: %v", req)
+
+	data, err := s.h.ServeLog(req)
+	reply := &Request{req.LUID, req.UUID, req.Version, errno(err), req.Seq, req.Type, data}
+	if err != nil {
+		log.Printf("DMULOG ERROR: %v", err)
+		reply.Data = nil
+	}
+
+	bs, err := reply.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return s.c.Reply(m, bs)
+}
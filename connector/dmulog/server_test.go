@@ -0,0 +1,145 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package dmulog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+func request(t RequestType, seq uint32, data []byte) []byte {
+	r := &Request{7, "LVM-test", Version, 0, seq, t, data}
+	bs, err := r.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return nltest.CnMsg(connector.DM, seq, bs)
+}
+
+func TestServe(t *testing.T) {
+	marks := append(Uint64(3), Uint64(5)...)
+	k := &nltest.Kernel{Requests: [][]byte{
+		request(Ctr, 1, []byte("core 1024\x00")),
+		// requests of other subsystems, garbage and truncated datagrams
+		// are skipped
+		nltest.CnMsg(connector.W1, 2, []byte{1, 2, 3}),
+		nltest.CnMsg(connector.DM, 3, []byte{1, 2, 3}),
+		nltest.CnMsg(connector.DM, 3, nil)[:12],
+		request(GetRegionSize, 4, nil),
+		request(MarkRegion, 5, marks),
+		request(IsRemoteRecovering, 6, nil),
+	}}
+
+	var marked []uint64
+	h := HandlerFunc(func(req *Request) ([]byte, error) {
+		if req.UUID != "LVM-test" || req.LUID != 7 {
+			t.Errorf("unexpected log %v", req)
+		}
+		switch req.Type {
+		case Ctr:
+			return nil, nil
+		case GetRegionSize:
+			return Uint64(1024), nil
+		case MarkRegion:
+			regions, err := req.Regions()
+			marked = append(marked, regions...)
+			return nil, err
+		}
+		return nil, syscall.EINVAL
+	})
+
+	err := NewServer(connector.New(k, connector.DM), h).Serve()
+	if err != nil {
+		t.Fatalf("could not serve: %v", err)
+	}
+
+	if len(k.Replies) != 4 {
+		t.Fatalf("unexpected reply count %d", len(k.Replies))
+	}
+	if len(marked) != 2 || marked[0] != 3 || marked[1] != 5 {
+		t.Errorf("unexpected marked regions %v", marked)
+	}
+
+	want := []struct {
+		seq  uint32
+		err  int32
+		data []byte
+	}{
+		{1, 0, nil},
+		{4, 0, Uint64(1024)},
+		{5, 0, nil},
+		{6, -int32(syscall.EINVAL), nil},
+	}
+	for i, w := range want {
+		reply := k.Replies[i]
+		if netlink.NativeEndian.Uint32(reply[8:]) != w.seq {
+			t.Errorf("reply %d: connector seq %d", i, netlink.NativeEndian.Uint32(reply[8:]))
+		}
+		r := &Request{}
+		err := r.UnmarshalBinary(reply[20:])
+		if err != nil {
+			t.Fatalf("reply %d: %v", i, err)
+		}
+		if r.Seq != w.seq || r.Error != w.err || !bytes.Equal(r.Data, w.data) {
+			t.Errorf("reply %d: unexpected %v error %d data %x", i, r, r.Error, r.Data)
+		}
+	}
+}
+
+func TestRequestInvalid(t *testing.T) {
+	bs := request(Flush, 1, Uint64(1))[20:]
+
+	r := &Request{}
+	if err := r.UnmarshalBinary(bs); err != nil || r.Type != Flush || r.UUID != "LVM-test" {
+		t.Fatalf("could not parse request: %v", err)
+	}
+	if err := r.UnmarshalBinary(bs[:requestHdrLen-1]); !errors.Is(err, netlink.ErrShortMessage) {
+		t.Errorf("unexpected error for short header: %v", err)
+	}
+	if err := r.UnmarshalBinary(bs[:len(bs)-1]); !errors.Is(err, netlink.ErrShortMessage) {
+		t.Errorf("unexpected error for short data: %v", err)
+	}
+
+	r.Data = []byte{1, 2, 3}
+	if _, err := r.Regions(); !errors.Is(err, netlink.ErrInvalidLength) {
+		t.Errorf("unexpected error for partial region: %v", err)
+	}
+	if Ctr.String() != "DM_ULOG_CTR" || IsRemoteRecovering.String() != "DM_ULOG_IS_REMOTE_RECOVERING" {
+		t.Errorf("unexpected request type names")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	datagram := make([]byte, syscall.NLMSG_HDRLEN)
+	datagram = append(datagram, request(GetRegionSize, 4, nil)...)
+	netlink.NativeEndian.PutUint32(datagram, uint32(len(datagram)))
+	netlink.NativeEndian.PutUint16(datagram[4:], syscall.NLMSG_DONE)
+
+	s := netlink.Decode(syscall.NETLINK_CONNECTOR, datagram).String()
+	t.Log(s)
+	if !strings.Contains(s, "connector: dm (7:1)") || !strings.Contains(s, "dmulog: DM_ULOG_GET_REGION_SIZE") {
+		t.Errorf("unexpected decoding")
+	}
+}
@@ -0,0 +1,70 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package hyperv
+
+import (
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+func init() {
+	connector.RegisterDecoder(connector.KVP, decodeKVP)
+	connector.RegisterDecoder(connector.VSS, decodeVSS)
+}
+
+// decodeKVP renders a key value pair message. The header of replies holds
+// a status instead of the operation, so both are shown.
+func decodeKVP(n *netlink.Node, data []byte) {
+	m := &KVPMsg{}
+	err := m.UnmarshalBinary(data)
+	if err != nil {
+		n.AddHex("invalid message", data)
+		return
+	}
+
+	k := n.Add("kvp", "%v", m.Op)
+	k.Add("pool", "%d", m.Pool)
+	k.Add("status", "%v", m.Status.String())
+	switch m.Op {
+	case KVPOpEnumerate:
+		k.Add("index", "%d", m.Index)
+		fallthrough
+	case KVPOpGet, KVPOpSet:
+		k.Add("type", "%d", m.ValueType)
+		k.Add("key", "%q", m.Key)
+		k.Add("value", "%q", m.Value)
+	case KVPOpDelete:
+		k.Add("key", "%q", m.Key)
+	case KVPOpRegister1:
+		k.Add("version", "%q", m.Version)
+	}
+}
+
+// decodeVSS renders a volume shadow copy message
+func decodeVSS(n *netlink.Node, data []byte) {
+	m := &VSSMsg{}
+	err := m.UnmarshalBinary(data)
+	if err != nil {
+		n.AddHex("invalid message", data)
+		return
+	}
+
+	v := n.Add("vss", "%v", m.Op)
+	v.Add("status", "%v", m.Status.String())
+	v.Add("flags", "0x%x", m.Flags)
+}
@@ -0,0 +1,294 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package hyperv implements the userspace side of the Hyper-V integration
+// services hv_utils talks to over Connector
+package hyperv
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// KVPOp is the operation of a key value pair message
+type KVPOp uint8
+
+// From uapi/linux/hyperv.h
+const (
+	KVPOpGet KVPOp = iota
+	KVPOpSet
+	KVPOpDelete
+	KVPOpEnumerate
+	KVPOpGetIPInfo
+	KVPOpSetIPInfo
+
+	// KVPOpRegister1 is the handshake of daemons supporting IP injection
+	KVPOpRegister1 KVPOp = 100
+)
+
+var kvpOpNames = []string{
+	"KVP_OP_GET",
+	"KVP_OP_SET",
+	"KVP_OP_DELETE",
+	"KVP_OP_ENUMERATE",
+	"KVP_OP_GET_IP_INFO",
+	"KVP_OP_SET_IP_INFO",
+}
+
+func (o KVPOp) String() string {
+	if o == KVPOpRegister1 {
+		return "KVP_OP_REGISTER1"
+	}
+	if int(o) < len(kvpOpNames) {
+		return kvpOpNames[o]
+	}
+	return fmt.Sprintf("KVP_OP_%d", uint8(o))
+}
+
+// KVPPool is a key value pool of the host
+type KVPPool uint8
+
+// From uapi/linux/hyperv.h
+const (
+	KVPPoolExternal KVPPool = iota
+	KVPPoolGuest
+	KVPPoolAuto
+	KVPPoolAutoExternal
+	KVPPoolAutoInternal
+)
+
+// ValueType is the registry type of a value
+type ValueType uint32
+
+// From uapi/linux/hyperv.h. The kernel converts all values to strings
+// before passing them on.
+const (
+	ValueString ValueType = 1
+	ValueU32    ValueType = 4
+	ValueU64    ValueType = 8
+)
+
+// Status is a Hyper-V status code, the outcome of a request
+type Status uint32
+
+// From uapi/linux/hyperv.h
+const (
+	StatusOK                 Status = 0x00000000
+	StatusFail               Status = 0x80004005
+	StatusCont               Status = 0x80070103
+	StatusNotSupported       Status = 0x80070032
+	StatusMachineLocked      Status = 0x800704f7
+	StatusDeviceNotConnected Status = 0x8007048f
+	StatusInvalidArg         Status = 0x80070057
+	StatusGUIDNotFound       Status = 0x80041002
+	StatusAlreadyExists      Status = 0x80070050
+	StatusDiskFull           Status = 0x80070070
+)
+
+var statusNames = map[Status]string{
+	StatusOK:                 "HV_S_OK",
+	StatusFail:               "HV_E_FAIL",
+	StatusCont:               "HV_S_CONT",
+	StatusNotSupported:       "HV_ERROR_NOT_SUPPORTED",
+	StatusMachineLocked:      "HV_ERROR_MACHINE_LOCKED",
+	StatusDeviceNotConnected: "HV_ERROR_DEVICE_NOT_CONNECTED",
+	StatusInvalidArg:         "HV_INVALIDARG",
+	StatusGUIDNotFound:       "HV_GUID_NOTFOUND",
+	StatusAlreadyExists:      "HV_ERROR_ALREADY_EXISTS",
+	StatusDiskFull:           "HV_ERROR_DISK_FULL",
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08x", uint32(s))
+}
+
+// Error makes a Status usable as error of a KVPHandler
+func (s Status) Error() string {
+	return "hyperv: " + s.String()
+}
+
+// Layout of struct hv_kvp_msg, from uapi/linux/hyperv.h
+const (
+	kvpMsgLen   = 7432
+	kvpKeyMax   = 512
+	kvpValueMax = 2048
+
+	// offsets of struct hv_kvp_exchg_msg_value in the message
+	kvpValueOff = 4
+	kvpEnumOff  = 8
+)
+
+// KVPMsg is a key value pair message, struct hv_kvp_msg. Keys and values
+// are UTF-8 strings, the kernel converts them from and to the host's
+// UTF-16.
+type KVPMsg struct {
+	Op   KVPOp
+	Pool KVPPool
+	// Status is the outcome reported by a reply. It is stored in place of
+	// Op and Pool.
+	Status Status
+	// Index is the position asked for by KVPOpEnumerate
+	Index     uint32
+	ValueType ValueType
+	Key       string
+	Value     string
+	// Version is exchanged by the register handshake
+	Version string
+}
+
+func (m *KVPMsg) String() string {
+	return fmt.Sprintf("KVPMsg{%v, pool %d, status %v, index %d, key %q, value %q}", m.Op, m.Pool, m.Status.String(), m.Index, m.Key, m.Value)
+}
+
+// cString reads a NUL terminated string of at most size bytes from bs. A
+// size of 0 is left unset by replies, their strings end at the NUL.
+func cString(bs []byte, size uint32, max int) (string, error) {
+	if size > uint32(max) {
+		return "", &netlink.ParseError{Layer: "hyperv", Err: netlink.ErrInvalidLength, Want: max, Have: int(size)}
+	}
+	if size == 0 {
+		size = uint32(max)
+	}
+	s := bs[:size]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s), nil
+}
+
+// putCString writes s with a NUL terminator to b and returns its size
+func putCString(b []byte, s string, max int) (uint32, error) {
+	if len(s) >= max {
+		return 0, fmt.Errorf("hyperv: string of %d bytes exceeds the maximum of %d", len(s), max-1)
+	}
+	copy(b, s)
+	return uint32(len(s) + 1), nil
+}
+
+// UnmarshalBinary reads a message from bs. The body is interpreted
+// according to Op, which only holds for requests of the kernel.
+func (m *KVPMsg) UnmarshalBinary(bs []byte) error {
+	if len(bs) < kvpMsgLen {
+		return &netlink.ParseError{Layer: "hyperv", Err: netlink.ErrShortMessage, Want: kvpMsgLen, Have: len(bs)}
+	}
+	*m = KVPMsg{
+		Op:     KVPOp(bs[0]),
+		Pool:   KVPPool(bs[1]),
+		Status: Status(netlink.NativeEndian.Uint32(bs[0:])),
+	}
+
+	var err error
+	switch m.Op {
+	case KVPOpGet, KVPOpSet:
+		err = m.unmarshalValue(bs[kvpValueOff:])
+	case KVPOpEnumerate:
+		m.Index = netlink.NativeEndian.Uint32(bs[4:])
+		err = m.unmarshalValue(bs[kvpEnumOff:])
+	case KVPOpDelete:
+		m.Key, err = cString(bs[8:], netlink.NativeEndian.Uint32(bs[4:]), kvpKeyMax)
+	case KVPOpRegister1:
+		m.Version, err = cString(bs[4:], kvpKeyMax, kvpKeyMax)
+	}
+	return err
+}
+
+// unmarshalValue reads a struct hv_kvp_exchg_msg_value
+func (m *KVPMsg) unmarshalValue(bs []byte) (err error) {
+	m.ValueType = ValueType(netlink.NativeEndian.Uint32(bs[0:]))
+	m.Key, err = cString(bs[12:], netlink.NativeEndian.Uint32(bs[4:]), kvpKeyMax)
+	if err != nil {
+		return
+	}
+	m.Value, err = cString(bs[12+kvpKeyMax:], netlink.NativeEndian.Uint32(bs[8:]), kvpValueMax)
+	return
+}
+
+// AppendBinary appends the wire format of m, with Op and Pool in the
+// header, to b
+func (m *KVPMsg) AppendBinary(b []byte) ([]byte, error) {
+	return m.appendBinary(b, false)
+}
+
+// MarshalBinary returns the wire format of m, with Op and Pool in the header
+func (m *KVPMsg) MarshalBinary() ([]byte, error) {
+	return m.appendBinary(make([]byte, 0, kvpMsgLen), false)
+}
+
+// MarshalReply returns the wire format of m as reply, with Status in the
+// header. The body is laid out according to Op and holds just the strings,
+// like the replies of hv_kvp_daemon, as the kernel measures them itself.
+func (m *KVPMsg) MarshalReply() ([]byte, error) {
+	return m.appendBinary(make([]byte, 0, kvpMsgLen), true)
+}
+
+func (m *KVPMsg) appendBinary(b []byte, reply bool) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, kvpMsgLen)...)
+	msg := b[n:]
+	if reply {
+		netlink.NativeEndian.PutUint32(msg[0:], uint32(m.Status))
+	} else {
+		msg[0] = byte(m.Op)
+		msg[1] = byte(m.Pool)
+	}
+
+	var err error
+	switch m.Op {
+	case KVPOpGet, KVPOpSet:
+		err = m.putValue(msg[kvpValueOff:], reply)
+	case KVPOpEnumerate:
+		netlink.NativeEndian.PutUint32(msg[4:], m.Index)
+		err = m.putValue(msg[kvpEnumOff:], reply)
+	case KVPOpDelete:
+		var size uint32
+		size, err = putCString(msg[8:], m.Key, kvpKeyMax)
+		if !reply {
+			netlink.NativeEndian.PutUint32(msg[4:], size)
+		}
+	case KVPOpRegister1:
+		_, err = putCString(msg[4:], m.Version, kvpKeyMax)
+	}
+	if err != nil {
+		return b[:n], err
+	}
+	return b, nil
+}
+
+// putValue writes a struct hv_kvp_exchg_msg_value, only its strings for a
+// reply
+func (m *KVPMsg) putValue(b []byte, reply bool) error {
+	keySize, err := putCString(b[12:], m.Key, kvpKeyMax)
+	if err != nil {
+		return err
+	}
+	valueSize, err := putCString(b[12+kvpKeyMax:], m.Value, kvpValueMax)
+	if err != nil {
+		return err
+	}
+	if reply {
+		return nil
+	}
+	netlink.NativeEndian.PutUint32(b[0:], uint32(m.ValueType))
+	netlink.NativeEndian.PutUint32(b[4:], keySize)
+	netlink.NativeEndian.PutUint32(b[8:], valueSize)
+	return nil
+}
@@ -0,0 +1,154 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package hyperv
+
+import (
+	"errors"
+
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/log"
+)
+
+// daemonVersion is announced to the kernel by the register handshake
+const daemonVersion = "go-netlink"
+
+// ErrNotFound is returned by a KVPHandler for unknown keys and indices
+var ErrNotFound = errors.New("hyperv: no such key")
+
+// KVPHandler serves the key value pool requests of the host, as
+// hv_kvp_daemon does. ErrNotFound is reported to the host as StatusCont,
+// a Status as itself and any other error as StatusFail.
+type KVPHandler interface {
+	Get(pool KVPPool, key string) (value string, err error)
+	Set(pool KVPPool, key, value string) error
+	Delete(pool KVPPool, key string) error
+	// Enumerate returns the key value pair at index. The host iterates
+	// until it gets an error.
+	Enumerate(pool KVPPool, index uint32) (key, value string, err error)
+}
+
+// status returns the Status the host expects for err
+func status(err error) Status {
+	var s Status
+	switch {
+	case err == nil:
+		return StatusOK
+	case errors.As(err, &s):
+		return s
+	case errors.Is(err, ErrNotFound):
+		return StatusCont
+	}
+	return StatusFail
+}
+
+// KVPServer answers the kernel's key value pair requests with a KVPHandler
+type KVPServer struct {
+	c *connector.Connector
+	h KVPHandler
+}
+
+// NewKVPServer returns a KVPServer for the requests received on c, which
+// must be opened for connector.KVP and have joined its group
+func NewKVPServer(c *connector.Connector, h KVPHandler) *KVPServer {
+	return &KVPServer{c, h}
+}
+
+// ListenAndServeKVP opens a Connector for the key value pair requests of
+// the kernel and serves them with h
+func ListenAndServeKVP(h KVPHandler) error {
+	c, err := connector.Open(connector.KVP)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.Join()
+	if err != nil {
+		return err
+	}
+	return NewKVPServer(c, h).Serve()
+}
+
+// Serve registers with the kernel and answers requests one by one until
+// receiving fails. It returns nil once the transport has no more requests,
+// such as a finished replay. IP injection requests are answered with
+// StatusFail.
+func (s *KVPServer) Serve() error {
+	reg := &KVPMsg{Op: KVPOpRegister1, Version: daemonVersion}
+	bs, err := reg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = s.c.Send(bs)
+	if err != nil {
+		return err
+	}
+
+	return s.c.Serve(s.answer)
+}
+
+// answer replies to the request in m
+func (s *KVPServer) answer(m *connector.Message) error {
+	req := &KVPMsg{}
+	err := req.UnmarshalBinary(m.Data)
+	if err != nil {
+		log.Printf("KVP SKIP: %v", err)
+		return nil
+	}
+	if req.Op == KVPOpRegister1 {
+		log.Printf("KVP REGISTERED: kernel version %q", req.Version)
+		return nil
+	}
+	log.Printf("KVP REQUEST: %v", req)
+
+	bs, err := s.serve(req).MarshalReply()
+	if err != nil {
+		log.Printf("KVP ERROR: %v", err)
+		req.Status = StatusFail
+		bs, err = req.MarshalReply()
+		if err != nil {
+			return err
+		}
+	}
+	return s.c.Reply(m, bs)
+}
+
+// serve runs the handler for req and returns the reply
+func (s *KVPServer) serve(req *KVPMsg) *KVPMsg {
+	reply := *req
+	var err error
+	switch req.Op {
+	case KVPOpGet:
+		reply.Value, err = s.h.Get(req.Pool, req.Key)
+		reply.ValueType = ValueString
+	case KVPOpSet:
+		err = s.h.Set(req.Pool, req.Key, req.Value)
+	case KVPOpDelete:
+		err = s.h.Delete(req.Pool, req.Key)
+	case KVPOpEnumerate:
+		reply.Key, reply.Value, err = s.h.Enumerate(req.Pool, req.Index)
+		reply.ValueType = ValueString
+	default:
+		err = StatusFail
+	}
+	if err != nil {
+		log.Printf("KVP ERROR: %v", err)
+	}
+	reply.Status = status(err)
+	return &reply
+}
@@ -0,0 +1,249 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package hyperv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+func request(seq uint32, m *KVPMsg) []byte {
+	bs, err := m.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return nltest.CnMsg(connector.KVP, seq, bs)
+}
+
+// pool is a KVPHandler backed by a list of pairs
+type pool struct {
+	keys, values []string
+}
+
+func (p *pool) Get(_ KVPPool, key string) (string, error) {
+	for i, k := range p.keys {
+		if k == key {
+			return p.values[i], nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+func (p *pool) Set(_ KVPPool, key, value string) error {
+	p.keys = append(p.keys, key)
+	p.values = append(p.values, value)
+	return nil
+}
+
+func (p *pool) Delete(_ KVPPool, key string) error {
+	return StatusAlreadyExists
+}
+
+func (p *pool) Enumerate(_ KVPPool, index uint32) (string, string, error) {
+	if int(index) >= len(p.keys) {
+		return "", "", ErrNotFound
+	}
+	return p.keys[index], p.values[index], nil
+}
+
+func TestServeKVP(t *testing.T) {
+	k := &nltest.Kernel{Requests: [][]byte{
+		request(0, &KVPMsg{Op: KVPOpRegister1, Version: "3.1"}),
+		request(1, &KVPMsg{Op: KVPOpSet, Pool: KVPPoolExternal, ValueType: ValueString, Key: "Name", Value: "build-07"}),
+		// requests of other subsystems, garbage and truncated datagrams
+		// are skipped
+		nltest.CnMsg(connector.VSS, 2, make([]byte, vssMsgLen)),
+		nltest.CnMsg(connector.KVP, 3, []byte{1, 2, 3}),
+		nltest.CnMsg(connector.KVP, 3, nil)[:12],
+		request(4, &KVPMsg{Op: KVPOpGet, Key: "Name"}),
+		request(5, &KVPMsg{Op: KVPOpGet, Key: "Missing"}),
+		request(6, &KVPMsg{Op: KVPOpEnumerate, Pool: KVPPoolAuto, Index: 0}),
+		request(7, &KVPMsg{Op: KVPOpEnumerate, Pool: KVPPoolAuto, Index: 1}),
+		request(8, &KVPMsg{Op: KVPOpDelete, Key: "Name"}),
+		request(9, &KVPMsg{Op: KVPOpGetIPInfo}),
+	}}
+
+	p := &pool{}
+	err := NewKVPServer(connector.New(k, connector.KVP), p).Serve()
+	if err != nil {
+		t.Fatalf("could not serve: %v", err)
+	}
+
+	if len(k.Replies) != 8 {
+		t.Fatalf("unexpected reply count %d", len(k.Replies))
+	}
+	reg := &KVPMsg{}
+	if err := reg.UnmarshalBinary(k.Replies[0][20:]); err != nil || reg.Op != KVPOpRegister1 || reg.Version != daemonVersion {
+		t.Errorf("unexpected registration %v: %v", reg, err)
+	}
+	if len(p.keys) != 1 || p.keys[0] != "Name" || p.values[0] != "build-07" {
+		t.Errorf("unexpected pool %v", p)
+	}
+
+	want := []struct {
+		seq    uint32
+		op     KVPOp
+		status Status
+		key    string
+		value  string
+	}{
+		{1, KVPOpSet, StatusOK, "Name", "build-07"},
+		{4, KVPOpGet, StatusOK, "Name", "build-07"},
+		{5, KVPOpGet, StatusCont, "Missing", ""},
+		{6, KVPOpEnumerate, StatusOK, "Name", "build-07"},
+		{7, KVPOpEnumerate, StatusCont, "", ""},
+		{8, KVPOpDelete, StatusAlreadyExists, "Name", ""},
+		{9, KVPOpGetIPInfo, StatusFail, "", ""},
+	}
+	for i, w := range want {
+		reply := k.Replies[i+1]
+		if netlink.NativeEndian.Uint32(reply[8:]) != w.seq {
+			t.Errorf("reply %d: connector seq %d", i, netlink.NativeEndian.Uint32(reply[8:]))
+		}
+		if len(reply) != 20+kvpMsgLen {
+			t.Fatalf("reply %d: unexpected length %d", i, len(reply))
+		}
+		s := Status(netlink.NativeEndian.Uint32(reply[20:]))
+		if s != w.status {
+			t.Errorf("reply %d: unexpected status %v", i, s)
+		}
+
+		// read the body as the kernel does, by the op it asked for
+		bs := append([]byte{}, reply[20:]...)
+		bs[0], bs[1] = byte(w.op), 0
+		r := &KVPMsg{}
+		err := r.UnmarshalBinary(bs)
+		if err != nil {
+			t.Fatalf("reply %d: %v", i, err)
+		}
+		if r.Key != w.key || r.Value != w.value {
+			t.Errorf("reply %d: unexpected %v", i, r)
+		}
+	}
+}
+
+// TestKVPLayout checks the wire format against the offsets of struct
+// hv_kvp_msg in include/uapi/linux/hyperv.h on an x86 guest
+func TestKVPLayout(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	// kvp_hdr, then kvp_set.data: value_type, key_size, value_size, key
+	// and value
+	set := make([]byte, 7432)
+	set[0], set[1] = 1, 0
+	binary.LittleEndian.PutUint32(set[4:], 1)
+	binary.LittleEndian.PutUint32(set[8:], 19)
+	binary.LittleEndian.PutUint32(set[12:], 9)
+	copy(set[16:], "VirtualMachineName")
+	copy(set[528:], "build-07")
+
+	// error, then kvp_enum_data: index and data, of which hv_kvp_daemon
+	// fills in the strings only
+	enumerated := make([]byte, 7432)
+	binary.LittleEndian.PutUint32(enumerated[4:], 1)
+	copy(enumerated[20:], "IntegrationServicesVersion")
+	copy(enumerated[532:], "6.18")
+
+	// the status of a request reads its op and pool
+	msg := KVPMsg{Op: KVPOpSet, Pool: KVPPoolExternal, Status: 1, ValueType: ValueString, Key: "VirtualMachineName", Value: "build-07"}
+	bs, err := msg.MarshalBinary()
+	if err != nil || !bytes.Equal(bs, set) {
+		t.Errorf("unexpected set request: %v", err)
+	}
+	m := &KVPMsg{}
+	err = m.UnmarshalBinary(set)
+	if err != nil || *m != msg {
+		t.Errorf("unexpected %v: %v", m, err)
+	}
+
+	reply := KVPMsg{Op: KVPOpEnumerate, Status: StatusOK, Index: 1, ValueType: ValueString, Key: "IntegrationServicesVersion", Value: "6.18"}
+	bs, err = reply.MarshalReply()
+	if err != nil || !bytes.Equal(bs, enumerated) {
+		t.Errorf("unexpected enumerate reply: %v", err)
+	}
+}
+
+func TestKVPMsgInvalid(t *testing.T) {
+	m := &KVPMsg{Op: KVPOpGet, Key: "Name"}
+	bs, err := m.MarshalBinary()
+	if err != nil || len(bs) != kvpMsgLen {
+		t.Fatalf("could not marshal: %v", err)
+	}
+
+	if err := m.UnmarshalBinary(bs[:kvpMsgLen-1]); !errors.Is(err, netlink.ErrShortMessage) {
+		t.Errorf("unexpected error for short message: %v", err)
+	}
+	netlink.NativeEndian.PutUint32(bs[kvpValueOff+4:], kvpKeyMax+1)
+	if err := m.UnmarshalBinary(bs); !errors.Is(err, netlink.ErrInvalidLength) {
+		t.Errorf("unexpected error for key size: %v", err)
+	}
+
+	m.Key = strings.Repeat("k", kvpKeyMax)
+	if _, err := m.MarshalBinary(); err == nil {
+		t.Errorf("marshalled oversized key")
+	}
+
+	if KVPOpRegister1.String() != "KVP_OP_REGISTER1" || StatusCont.String() != "HV_S_CONT" || status(syscall.EIO) != StatusFail {
+		t.Errorf("unexpected names")
+	}
+}
+
+func TestVSSMsg(t *testing.T) {
+	m := &VSSMsg{Op: VSSOpHotBackup, Flags: VSSNoAutoRecovery}
+	bs, err := m.MarshalBinary()
+	if err != nil || len(bs) != vssMsgLen {
+		t.Fatalf("could not marshal: %v", err)
+	}
+
+	r := &VSSMsg{}
+	err = r.UnmarshalBinary(bs)
+	if err != nil || r.Op != VSSOpHotBackup || r.Flags != VSSNoAutoRecovery {
+		t.Errorf("unexpected %v: %v", r, err)
+	}
+	if err := r.UnmarshalBinary(bs[:vssMsgLen-1]); !errors.Is(err, netlink.ErrShortMessage) {
+		t.Errorf("unexpected error for short message: %v", err)
+	}
+
+	m.Status = StatusFail
+	bs, _ = m.MarshalReply()
+	_ = r.UnmarshalBinary(bs)
+	if r.Status != StatusFail || VSSOpRegister1.String() != "VSS_OP_REGISTER1" {
+		t.Errorf("unexpected reply %v", r)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	datagram := make([]byte, syscall.NLMSG_HDRLEN)
+	datagram = append(datagram, request(4, &KVPMsg{Op: KVPOpGet, Key: "Name"})...)
+	netlink.NativeEndian.PutUint32(datagram, uint32(len(datagram)))
+	netlink.NativeEndian.PutUint16(datagram[4:], syscall.NLMSG_DONE)
+
+	s := netlink.Decode(syscall.NETLINK_CONNECTOR, datagram).String()
+	t.Log(s)
+	if !strings.Contains(s, "connector: kvp (9:1)") || !strings.Contains(s, "kvp: KVP_OP_GET") || !strings.Contains(s, `"Name"`) {
+		t.Errorf("unexpected decoding")
+	}
+}
@@ -0,0 +1,123 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package hyperv
+
+import (
+	"fmt"
+
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// VSSOp is the operation of a volume shadow copy message
+type VSSOp uint8
+
+// From uapi/linux/hyperv.h
+const (
+	VSSOpCreate VSSOp = iota
+	VSSOpDelete
+	VSSOpHotBackup
+	VSSOpGetDMInfo
+	VSSOpBUComplete
+	VSSOpFreeze
+	VSSOpThaw
+	VSSOpAutoRecover
+
+	// VSSOpRegister is the handshake of daemons without full handshake
+	// support
+	VSSOpRegister VSSOp = 128
+	// VSSOpRegister1 is the handshake of current daemons
+	VSSOpRegister1 VSSOp = 129
+)
+
+var vssOpNames = []string{
+	"VSS_OP_CREATE",
+	"VSS_OP_DELETE",
+	"VSS_OP_HOT_BACKUP",
+	"VSS_OP_GET_DM_INFO",
+	"VSS_OP_BU_COMPLETE",
+	"VSS_OP_FREEZE",
+	"VSS_OP_THAW",
+	"VSS_OP_AUTO_RECOVER",
+}
+
+func (o VSSOp) String() string {
+	switch {
+	case o == VSSOpRegister:
+		return "VSS_OP_REGISTER"
+	case o == VSSOpRegister1:
+		return "VSS_OP_REGISTER1"
+	case int(o) < len(vssOpNames):
+		return vssOpNames[o]
+	}
+	return fmt.Sprintf("VSS_OP_%d", uint8(o))
+}
+
+// VSSNoAutoRecovery is the only feature flag Linux reports to the host
+const VSSNoAutoRecovery = 0x00000005
+
+// vssMsgLen is the length of struct hv_vss_msg. Freeze requests of the
+// host carry more data, which the kernel passes on but nobody reads.
+const vssMsgLen = 12
+
+// VSSMsg is a volume shadow copy message, struct hv_vss_msg
+type VSSMsg struct {
+	Op VSSOp
+	// Status is the outcome reported by a reply. It is stored in place of
+	// Op.
+	Status Status
+	// Flags are the features of VSSOpHotBackup and VSSOpGetDMInfo
+	Flags uint32
+}
+
+func (m *VSSMsg) String() string {
+	return fmt.Sprintf("VSSMsg{%v, status %v, flags 0x%x}", m.Op, m.Status.String(), m.Flags)
+}
+
+// UnmarshalBinary reads a message from bs
+func (m *VSSMsg) UnmarshalBinary(bs []byte) error {
+	if len(bs) < vssMsgLen {
+		return &netlink.ParseError{Layer: "hyperv", Err: netlink.ErrShortMessage, Want: vssMsgLen, Have: len(bs)}
+	}
+	m.Op = VSSOp(bs[0])
+	m.Status = Status(netlink.NativeEndian.Uint32(bs[0:]))
+	m.Flags = netlink.NativeEndian.Uint32(bs[8:])
+	return nil
+}
+
+// AppendBinary appends the wire format of m, with Op in the header, to b
+func (m *VSSMsg) AppendBinary(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, vssMsgLen)...)
+	b[n] = byte(m.Op)
+	netlink.NativeEndian.PutUint32(b[n+8:], m.Flags)
+	return b, nil
+}
+
+// MarshalBinary returns the wire format of m, with Op in the header
+func (m *VSSMsg) MarshalBinary() ([]byte, error) {
+	return m.AppendBinary(make([]byte, 0, vssMsgLen))
+}
+
+// MarshalReply returns the wire format of m as reply, with Status in the
+// header
+func (m *VSSMsg) MarshalReply() ([]byte, error) {
+	b := make([]byte, vssMsgLen)
+	netlink.NativeEndian.PutUint32(b[0:], uint32(m.Status))
+	netlink.NativeEndian.PutUint32(b[8:], m.Flags)
+	return b, nil
+}
@@ -0,0 +1,124 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package connector
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CbID identifies a Connector subsystem by an index and a value
+type CbID struct {
+	idx uint32
+	val uint32
+}
+
+// NewCbID returns the CbID with the given index and value
+func NewCbID(idx, val uint32) CbID {
+	return CbID{idx, val}
+}
+
+// Idx returns the index of the CbID, which is also its multicast group
+func (id CbID) Idx() uint32 {
+	return id.idx
+}
+
+// Val returns the value of the CbID
+func (id CbID) Val() uint32 {
+	return id.val
+}
+
+func (id CbID) String() string {
+	if name, ok := Name(id); ok {
+		return name
+	}
+	return fmt.Sprintf("CbID{%d, %d}", id.idx, id.val)
+}
+
+// The kernel's Connector users, from uapi/linux/connector.h
+var (
+	// Proc is the process events connector
+	Proc = CbID{1, 1}
+	// CIFS is the CIFS upcall connector
+	CIFS = CbID{2, 1}
+	// W1 is the CbID of the 1-Wire subsystem
+	W1 = CbID{3, 1}
+	// V86D is the uvesafb connector to the v86d helper
+	V86D = CbID{4, 2}
+	// BB is the index reserved for BlackBoard, it has no value defined
+	BB = CbID{5, 0}
+	// DST is the distributed storage connector
+	DST = CbID{6, 1}
+	// DM is the device-mapper userspace log connector
+	DM = CbID{7, 1}
+	// DRBD is the DRBD connector
+	DRBD = CbID{8, 1}
+	// KVP is the Hyper-V key value pair connector
+	KVP = CbID{9, 1}
+	// VSS is the Hyper-V volume shadow copy connector
+	VSS = CbID{10, 1}
+)
+
+// NetlinkUsers is the first index not used by the kernel
+const NetlinkUsers = 11
+
+var registry = struct {
+	sync.RWMutex
+	names map[CbID]string
+	ids   map[string]CbID
+}{
+	names: map[CbID]string{},
+	ids:   map[string]CbID{},
+}
+
+func init() {
+	Register(Proc, "proc")
+	Register(CIFS, "cifs")
+	Register(W1, "w1")
+	Register(V86D, "v86d")
+	Register(BB, "bb")
+	Register(DST, "dst")
+	Register(DM, "dm")
+	Register(DRBD, "drbd")
+	Register(KVP, "kvp")
+	Register(VSS, "vss")
+}
+
+// Register names the given CbID, for subsystems not known to this package
+func Register(id CbID, name string) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.names[id] = name
+	registry.ids[name] = id
+}
+
+// Name returns the registered name of the given CbID
+func Name(id CbID) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	name, ok := registry.names[id]
+	return name, ok
+}
+
+// Lookup returns the CbID registered under the given name
+func Lookup(name string) (CbID, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	id, ok := registry.ids[name]
+	return id, ok
+}
@@ -0,0 +1,44 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package connector
+
+import "testing"
+
+func TestCbID(t *testing.T) {
+	id := NewCbID(3, 1)
+	assert(t, id == W1)
+	assert(t, id.Idx() == 3 && id.Val() == 1)
+	assert(t, id.String() == "w1")
+	assert(t, NewCbID(cnTestIdx, cnTestVal).String() == "CbID{14, 1110}")
+
+	kvp, ok := Lookup("kvp")
+	assert(t, ok && kvp == KVP)
+	_, ok = Lookup("test")
+	assert(t, !ok)
+
+	Register(NewCbID(cnTestIdx, cnTestVal), "test")
+	defer func() {
+		registry.Lock()
+		delete(registry.names, NewCbID(cnTestIdx, cnTestVal))
+		delete(registry.ids, "test")
+		registry.Unlock()
+	}()
+	id, ok = Lookup("test")
+	assert(t, ok && id.Idx() == cnTestIdx)
+	assert(t, id.String() == "test")
+}
@@ -0,0 +1,156 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package connector
+
+import (
+	"io"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/lambdasoup/go-netlink/log"
+)
+
+// how often a Listener on a netlink.Socket checks whether it was closed
+const listenPoll = 200 * time.Millisecond
+
+// number of messages buffered by a Listener before it stops receiving
+const listenQueueLen = 64
+
+// Listener delivers the unsolicited messages a subsystem broadcasts to its
+// multicast group, such as 1-Wire master and slave hotplug events. It uses
+// a Connector of its own, apart from request and response traffic.
+type Listener struct {
+	c        *Connector
+	messages chan *Message
+	done     chan struct{}
+	once     sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// Listen opens a Listener for the broadcasts of the given CbID
+func Listen(id CbID) (*Listener, error) {
+	c, err := Open(id)
+	if err != nil {
+		return nil, err
+	}
+	l, err := NewListener(c)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewListener subscribes c to the multicast group of its CbID and starts
+// delivering the messages it receives. The Listener takes ownership of c.
+func NewListener(c *Connector) (*Listener, error) {
+	err := c.Join()
+	if err != nil {
+		return nil, err
+	}
+
+	// wake up regularly to notice Close
+	if s, ok := c.t.(interface {
+		SetReceiveTimeout(time.Duration) error
+	}); ok {
+		err = s.SetReceiveTimeout(listenPoll)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l := &Listener{
+		c:        c,
+		messages: make(chan *Message, listenQueueLen),
+		done:     make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Messages returns the channel of received messages. It is closed when the
+// Listener is closed or fails, see Err.
+func (l *Listener) Messages() <-chan *Message {
+	return l.messages
+}
+
+// Err returns the error which stopped the Listener, if any
+func (l *Listener) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close stops the Listener. Its Connector is closed by the receive loop
+// once that notices, which takes up to 200ms on a netlink.Socket.
+func (l *Listener) Close() {
+	l.once.Do(func() { close(l.done) })
+}
+
+func (l *Listener) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *Listener) run() {
+	defer close(l.messages)
+	defer l.c.Close()
+
+	for {
+		data, err := l.c.t.Receive()
+		if l.closed() {
+			return
+		}
+		if err == syscall.EAGAIN {
+			continue
+		}
+		// the transport has nothing more to deliver, e.g. a replayed capture
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			l.mu.Lock()
+			l.err = err
+			l.mu.Unlock()
+			return
+		}
+
+		m, err := parseConnectorMsg(data)
+		if err != nil {
+			log.Printf("\t\tCN LISTEN SKIP: %v", err)
+			continue
+		}
+		if m.id != l.c.id {
+			continue
+		}
+		log.Printf("\t\tCN LISTEN: %v", m)
+
+		select {
+		case l.messages <- m.message():
+		case <-l.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package connector
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// broadcaster is a netlink.Transport delivering queued broadcasts. Once
+// drained it times out like a Socket with a receive timeout, or ends with
+// io.EOF if eof is set.
+type broadcaster struct {
+	group  uint32
+	queue  [][]byte
+	eof    bool
+	closed chan struct{}
+}
+
+func (b *broadcaster) JoinGroup(group uint32) error {
+	b.group = group
+	return nil
+}
+
+func (b *broadcaster) Send(data []byte) error {
+	return syscall.EOPNOTSUPP
+}
+
+func (b *broadcaster) Receive() ([]byte, error) {
+	if len(b.queue) > 0 {
+		data := b.queue[0]
+		b.queue = b.queue[1:]
+		return data, nil
+	}
+	if b.eof {
+		return nil, io.EOF
+	}
+	time.Sleep(time.Millisecond)
+	return nil, syscall.EAGAIN
+}
+
+func (b *broadcaster) Close() {
+	close(b.closed)
+}
+
+func TestListener(t *testing.T) {
+	other := CbID{cnTestIdx, cnTestVal}
+	b := &broadcaster{eof: true, closed: make(chan struct{})}
+	for _, m := range []*msg{
+		{W1, 1, 0, 0, 0, []byte{1}},
+		{other, 2, 0, 0, 0, []byte{2}},
+		{W1, 3, 0, 0, 1, []byte{3}},
+	} {
+		bs, err := m.MarshalBinary()
+		assert(t, err == nil)
+		b.queue = append(b.queue, bs)
+	}
+	// malformed broadcasts are skipped
+	b.queue = append(b.queue, []byte{1, 2, 3})
+
+	l, err := NewListener(New(b, W1))
+	assert(t, err == nil)
+	assert(t, b.group == W1.idx)
+
+	var got []*Message
+	for m := range l.Messages() {
+		got = append(got, m)
+	}
+	assert(t, l.Err() == nil)
+	assert(t, len(got) == 2)
+	assert(t, got[0].ID == W1 && got[0].Seq == 1 && bytes.Equal(got[0].Data, []byte{1}))
+	assert(t, got[1].Seq == 3 && got[1].Flags == 1)
+	<-b.closed
+}
+
+func TestListenerClose(t *testing.T) {
+	b := &broadcaster{closed: make(chan struct{})}
+	l, err := NewListener(New(b, W1))
+	assert(t, err == nil)
+
+	l.Close()
+	l.Close()
+	_, ok := <-l.Messages()
+	assert(t, !ok)
+	<-b.closed
+}
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/lambdasoup/go-netlink/log"
+	"github.com/lambdasoup/go-netlink/netlink"
 	"github.com/lambdasoup/go-netlink/w1"
 )
 
@@ -39,6 +40,10 @@ const (
 	startMission          = 0xCC
 )
 
+// pages read per READ MEMORY command, so that each read fits one w1
+// message
+const readMemoryPages = 64
+
 // device identifiers type
 type deviceID int
 
@@ -79,6 +84,9 @@ type Sample struct {
 // Temperature represents a temperature
 type Temperature float32
 
+// now is the clock used to set the device time, replaceable by tests
+var now = time.Now
+
 // Status returns the current iButton status
 func (b *Button) Status() (status *Status, err error) {
 	status = new(Status)
@@ -101,8 +109,56 @@ func (b *Button) Open() (err error) {
 		return
 	}
 
+	return b.open(w1)
+}
+
+// New opens a session with the first iButton reachable over the given transport
+func New(t netlink.Transport) (*Button, error) {
+	b := new(Button)
+	err := b.open(w1.New(t))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// OpenROM opens a session with the iButton of the given ROM ID, on
+// whichever master it is attached to
+func OpenROM(rom w1.ROM) (*Button, error) {
+	conn := new(w1.W1)
+	err := conn.Open()
+	if err != nil {
+		return nil, err
+	}
+	b, err := newROM(conn, rom)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewROM opens a session with the iButton of the given ROM ID reachable
+// over the given transport
+func NewROM(t netlink.Transport, rom w1.ROM) (*Button, error) {
+	return newROM(w1.New(t), rom)
+}
+
+func newROM(conn *w1.W1, rom w1.ROM) (*Button, error) {
+	if rom.Family() != 0x41 {
+		return nil, fmt.Errorf("%v is not an iButton data logger", rom)
+	}
+	s, err := conn.FindSlave(rom)
+	if err != nil {
+		return nil, err
+	}
+	return &Button{s}, nil
+}
+
+func (b *Button) open(conn *w1.W1) (err error) {
+
 	// find master
-	ms, err := w1.ListMasters()
+	ms, err := conn.ListMasters()
 	if err != nil {
 		err = fmt.Errorf("could not request list masters: %v\n", err)
 		return
@@ -114,7 +170,8 @@ func (b *Button) Open() (err error) {
 
 	// find ibutton slave
 	ss, err := ms[0].ListSlaves()
-	if err != nil {
+	// other slaves with corrupted ROM IDs are left out
+	if err != nil && !errors.Is(err, w1.ErrCRC) {
 		err = fmt.Errorf("could not request slaves: %v\n", err)
 		return
 	}
@@ -125,7 +182,7 @@ func (b *Button) Open() (err error) {
 	}
 	b.slave = &ss[0]
 
-	return
+	return nil
 }
 
 func filterFamily(ss []w1.Slave) (filtered []w1.Slave) {
@@ -192,8 +249,8 @@ func (b *Button) WriteScratchpad() error {
 	data[2] = 0x02
 
 	// write current time
-	now := time.Now()
-	serializeTime(data[2:], &now)
+	t := now()
+	serializeTime(data[2:], &t)
 
 	// sample rate (10mins with EHSS=0)
 	data[9] = 0x0A
@@ -293,6 +350,25 @@ func (b *Button) ReadLog() (samples []Sample, err error) {
 
 // ReadMemory reads the iButton's memory starting with the given address
 func (b *Button) readMemory(address uint16, pages int) (result []byte, err error) {
+	// each batch of pages selects the button and reads anew
+	for pages > 0 {
+		n := pages
+		if n > readMemoryPages {
+			n = readMemoryPages
+		}
+		data, err := b.readPages(address, n)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data...)
+		address += uint16(n * 32)
+		pages -= n
+	}
+	return
+}
+
+// readPages reads the given number of pages with a single READ MEMORY
+func (b *Button) readPages(address uint16, pages int) (result []byte, err error) {
 
 	// send the read command
 	cmd := make([]byte, 11)
@@ -305,11 +381,25 @@ func (b *Button) readMemory(address uint16, pages int) (result []byte, err error
 		return
 	}
 
+	return parsePages(cmd[:3], data, pages)
+}
+
+// parsePages verifies and strips the CRC16 of each page read from memory.
+// The first page's CRC also covers the read command and address.
+func parsePages(cmd []byte, data []byte, pages int) (result []byte, err error) {
+	if pages < 1 {
+		return []byte{}, nil
+	}
+	if len(data) < pages*34 {
+		err = &netlink.ParseError{Layer: "ibutton", Err: netlink.ErrShortMessage, Want: pages * 34, Have: len(data)}
+		return
+	}
+
 	result = make([]byte, pages*32)
 
 	// initial block has special crc checking
 	block := make([]byte, 3+34)
-	copy(block, cmd[:3])
+	copy(block, cmd)
 	copy(block[3:], data[:34])
 	checksum := 0xffff ^ (uint16(block[33+3])<<8 + uint16(block[32+3]))
 	if Checksum(block[:32+3]) != checksum {
@@ -22,14 +22,79 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"syscall"
 
 	"github.com/lambdasoup/go-netlink/ibutton"
 	"github.com/lambdasoup/go-netlink/log"
+	"github.com/lambdasoup/go-netlink/netlink"
+	"github.com/lambdasoup/go-netlink/w1"
 )
 
 // parse arguments
 var command = flag.String("command", "help", "displays general help")
 var logging = flag.Bool("debug", false, "toggle debug logging")
+var capture = flag.String("capture", "", "write netlink traffic to the given pcap file")
+var romID = flag.String("rom", "", "use the iButton of the given ROM ID, e.g. 41-00000012ab34, instead of the first one found")
+
+// open opens the iButton, capturing its traffic if requested
+func open() (*ibutton.Button, error) {
+	var rom w1.ROM
+	if *romID != "" {
+		var err error
+		rom, err = w1.ParseROM(*romID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if *capture == "" {
+		if *romID != "" {
+			return ibutton.OpenROM(rom)
+		}
+		button := new(ibutton.Button)
+		return button, button.Open()
+	}
+
+	f, err := os.Create(*capture)
+	if err != nil {
+		return nil, err
+	}
+	w, err := netlink.NewPcapWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s, err := netlink.Open(syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s.Tap(w)
+	t := &capturing{s, f}
+
+	var button *ibutton.Button
+	if *romID != "" {
+		button, err = ibutton.NewROM(t, rom)
+	} else {
+		button, err = ibutton.New(t)
+	}
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return button, nil
+}
+
+// capturing is a Socket which closes its capture file along with it
+type capturing struct {
+	*netlink.Socket
+	f *os.File
+}
+
+func (c *capturing) Close() {
+	c.Socket.Close()
+	c.f.Close()
+}
 
 func main() {
 
@@ -40,9 +105,8 @@ func main() {
 	switch *command {
 	case "status":
 
-		button := new(ibutton.Button)
-
-		if err := button.Open(); err != nil {
+		button, err := open()
+		if err != nil {
 			fmt.Printf("could not open iButton (%v)\n", err)
 			os.Exit(1)
 		}
@@ -67,13 +131,12 @@ func main() {
 		}())
 		fmt.Printf("rate:           %v\n", status.SampleRate())
 	case "clear":
-		button := new(ibutton.Button)
-		err := button.Open()
-		defer button.Close()
+		button, err := open()
 		if err != nil {
 			fmt.Printf("could not open button (%v)\n", err)
 			os.Exit(1)
 		}
+		defer button.Close()
 		err = button.ClearMemory()
 		if err != nil {
 			fmt.Printf("could not clear memory (%v)\n", err)
@@ -81,13 +144,12 @@ func main() {
 		}
 		fmt.Printf("Cleared Memory.\n")
 	case "start":
-		button := new(ibutton.Button)
-		err := button.Open()
-		defer button.Close()
+		button, err := open()
 		if err != nil {
 			fmt.Printf("could not open button (%v)\n", err)
 			os.Exit(1)
 		}
+		defer button.Close()
 		err = button.WriteScratchpad()
 		if err != nil {
 			fmt.Printf("could not write scratchpad (%v)\n", err)
@@ -115,13 +177,12 @@ func main() {
 		}
 		fmt.Printf("Started mission.\n")
 	case "read":
-		button := new(ibutton.Button)
-		err := button.Open()
-		defer button.Close()
+		button, err := open()
 		if err != nil {
 			fmt.Printf("could not open button (%v)\n", err)
 			os.Exit(1)
 		}
+		defer button.Close()
 		samples, err := button.ReadLog()
 		if err != nil {
 			fmt.Printf("could not read log (%v)\n", err)
@@ -131,13 +192,12 @@ func main() {
 			fmt.Printf("%v\t%3.3f°C\n", sample.Time, sample.Temp)
 		}
 	case "stop":
-		button := new(ibutton.Button)
-		err := button.Open()
-		defer button.Close()
+		button, err := open()
 		if err != nil {
 			fmt.Printf("could not open button (%v)\n", err)
 			os.Exit(1)
 		}
+		defer button.Close()
 		err = button.StopMission()
 		if err != nil {
 			fmt.Printf("could not stop mission (%v)\n", err)
@@ -18,8 +18,12 @@
 package ibutton
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/lambdasoup/go-netlink/netlink"
 )
 
 func TestParseTime(t *testing.T) {
@@ -56,3 +60,62 @@ func TestSerializeTime(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// pagesWithCRC returns memory pages as read from the device, each followed
+// by the inverted CRC16 of its data
+func pagesWithCRC(cmd []byte, memory []byte) []byte {
+	var data []byte
+	for page := 0; page < len(memory); page += 32 {
+		p := memory[page : page+32]
+		crc := Checksum(p)
+		if page == 0 {
+			crc = Checksum(append(append([]byte{}, cmd...), p...))
+		}
+		data = append(data, p...)
+		data = append(data, byte(^crc), byte(^crc>>8))
+	}
+	return data
+}
+
+func TestParsePages(t *testing.T) {
+	cmd := []byte{readMemory, 0x00, 0x10}
+	memory := make([]byte, 64)
+	for i := range memory {
+		memory[i] = byte(i)
+	}
+	data := pagesWithCRC(cmd, memory)
+
+	result, err := parsePages(cmd, data, 2)
+	if err != nil {
+		t.Fatalf("could not parse pages: %v", err)
+	}
+	if !bytes.Equal(result, memory) {
+		t.Errorf("unexpected memory %x", result)
+	}
+
+	_, err = parsePages(cmd, data[:67], 2)
+	if !errors.Is(err, netlink.ErrShortMessage) {
+		t.Errorf("unexpected error for short read: %v", err)
+	}
+
+	data[40]++
+	_, err = parsePages(cmd, data, 2)
+	if err == nil {
+		t.Errorf("corrupted page passed the crc check")
+	}
+}
+
+func FuzzParsePages(f *testing.F) {
+	cmd := []byte{readMemory, 0x00, 0x02}
+	f.Add(pagesWithCRC(cmd, make([]byte, 96)), 3)
+	f.Add([]byte{}, 1)
+	f.Fuzz(func(t *testing.T, data []byte, pages int) {
+		if pages > 1<<10 {
+			return
+		}
+		result, err := parsePages(cmd, data, pages)
+		if err == nil && len(result) != 32*pages && pages > 0 {
+			t.Errorf("got %d bytes for %d pages", len(result), pages)
+		}
+	})
+}
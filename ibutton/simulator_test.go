@@ -0,0 +1,299 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package ibutton
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lambdasoup/go-netlink/netlink"
+	"github.com/lambdasoup/go-netlink/w1"
+)
+
+// mission start time of the simulated button
+var missionStart = time.Date(2015, 11, 15, 16, 50, 0, 0, time.Local)
+
+// simulated 20.5°C samples, 16 bit resolution
+const simSamples = 20
+
+func TestStatus(t *testing.T) {
+	simulate(t, func(b *Button) {
+		status, err := b.Status()
+		if err != nil {
+			t.Fatalf("could not read status: %v", err)
+		}
+		if status.Name() != "DS1922L" {
+			t.Errorf("unexpected device %v", status.Name())
+		}
+		if !status.MissionInProgress() {
+			t.Errorf("mission not in progress")
+		}
+		if status.SampleCount() != simSamples {
+			t.Errorf("unexpected sample count %d", status.SampleCount())
+		}
+		if status.SampleRate() != 10*time.Minute {
+			t.Errorf("unexpected sample rate %v", status.SampleRate())
+		}
+		if !status.MissionTimestamp().Equal(missionStart) {
+			t.Errorf("unexpected mission start %v", status.MissionTimestamp())
+		}
+	})
+}
+
+func TestReadLog(t *testing.T) {
+	simulate(t, func(b *Button) {
+		samples, err := b.ReadLog()
+		if err != nil {
+			t.Fatalf("could not read log: %v", err)
+		}
+		if len(samples) != simSamples {
+			t.Fatalf("unexpected sample count %d", len(samples))
+		}
+		for i, s := range samples {
+			if !s.Time.Equal(missionStart.Add(time.Duration(i) * 10 * time.Minute)) {
+				t.Errorf("sample %d: unexpected time %v", i, s.Time)
+			}
+			if s.Temp != 20.5 {
+				t.Errorf("sample %d: unexpected temperature %v", i, s.Temp)
+			}
+		}
+	})
+}
+
+func TestStartMission(t *testing.T) {
+	now = func() time.Time { return time.Date(2015, 11, 15, 16, 53, 31, 0, time.Local) }
+	defer func() { now = time.Now }()
+
+	simulate(t, func(b *Button) {
+		err := b.WriteScratchpad()
+		if err != nil {
+			t.Fatalf("could not write scratchpad: %v", err)
+		}
+		data, err := b.ReadScratchpad()
+		if err != nil {
+			t.Fatalf("could not read scratchpad: %v", err)
+		}
+		if data[2] != 0x1F {
+			t.Fatalf("scratchpad verification failed")
+		}
+		err = b.CopyScratchpad()
+		if err != nil {
+			t.Fatalf("could not copy scratchpad: %v", err)
+		}
+		err = b.StartMission()
+		if err != nil {
+			t.Fatalf("could not start mission: %v", err)
+		}
+	})
+}
+
+func TestNewROM(t *testing.T) {
+	rom, _ := w1.ParseROM("41-00000012ab34")
+	b, err := NewROM(newSimulator(), rom)
+	if err != nil {
+		t.Fatalf("could not open button: %v", err)
+	}
+	status, err := b.Status()
+	if err != nil || status.Name() != "DS1922L" {
+		t.Errorf("unexpected status %v: %v", status, err)
+	}
+
+	other, _ := w1.ParseROM("41-000000000001")
+	_, err = NewROM(newSimulator(), other)
+	if !errors.Is(err, w1.ErrNotFound) {
+		t.Errorf("unexpected error for missing button: %v", err)
+	}
+	sensor, _ := w1.ParseROM("28-000000000001")
+	_, err = NewROM(newSimulator(), sensor)
+	if err == nil {
+		t.Errorf("opened a temperature sensor")
+	}
+}
+
+func TestReadMemoryBatches(t *testing.T) {
+	sim := newSimulator()
+	b, err := New(sim)
+	if err != nil {
+		t.Fatalf("could not open button: %v", err)
+	}
+
+	// the whole log memory takes several READ MEMORY commands
+	data, err := b.readMemory(0x1000, 256)
+	if err != nil {
+		t.Fatalf("could not read memory: %v", err)
+	}
+	if !bytes.Equal(data, sim.memory[0x1000:0x3000]) {
+		t.Errorf("unexpected memory contents")
+	}
+}
+
+// simulate runs fn against a Button on the simulated bus
+func simulate(t *testing.T, fn func(b *Button)) {
+	b, err := New(newSimulator())
+	if err != nil {
+		t.Fatalf("could not open simulated button: %v", err)
+	}
+	fn(b)
+}
+
+// w1 netlink message types and commands, from drivers/w1/w1_netlink.h
+const (
+	simMasterCmd   = 4
+	simSlaveCmd    = 5
+	simListMasters = 6
+
+	simCmdRead       = 0
+	simCmdWrite      = 1
+	simCmdListSlaves = 8
+)
+
+// simulator is a fake kernel with one w1 master and a DS1922L on its bus
+type simulator struct {
+	rom    []byte
+	memory []byte
+	stream []byte
+	queue  [][]byte
+}
+
+func newSimulator() *simulator {
+	s := &simulator{
+		rom:    []byte{0x41, 0x34, 0xab, 0x12, 0, 0, 0, 0xb7},
+		memory: make([]byte, 0x3000),
+	}
+
+	reg := s.memory[0x0200:]
+	serializeTime(reg[0x00:], &missionStart)
+	// sample rate 10 minutes
+	reg[0x06] = 0x0A
+	// oscillator on, low sample rate
+	reg[0x12] = 0x01
+	// 16 bit logging
+	reg[0x13] = 0xC5
+	// mission in progress
+	reg[0x15] = 0x02
+	serializeTime(reg[0x19:], &missionStart)
+	reg[0x20] = simSamples
+	reg[0x26] = DS1922L
+	// calibration reference temperatures, no deviation
+	copy(reg[0x40:], []byte{0x80, 0, 0x80, 0, 0xA0, 0, 0xA0, 0})
+
+	// 20.5°C = (0x7B / 2) - 41
+	for i := 0; i < simSamples; i++ {
+		s.memory[0x1000+2*i] = 0x7B
+	}
+
+	return s
+}
+
+func (s *simulator) Send(data []byte) error {
+	seq := netlink.NativeEndian.Uint32(data[8:])
+	ack := netlink.NativeEndian.Uint32(data[12:])
+	w1 := data[20:]
+
+	reply := func(ack uint32, w1Type byte, id []byte, body []byte) {
+		m := []byte{w1Type, 0, 0, 0}
+		netlink.NativeEndian.PutUint16(m[2:], uint16(len(body)))
+		m = append(m, id...)
+		m = append(m, body...)
+
+		cn := make([]byte, 20)
+		copy(cn, data[:8])
+		netlink.NativeEndian.PutUint32(cn[8:], seq)
+		netlink.NativeEndian.PutUint32(cn[12:], ack)
+		netlink.NativeEndian.PutUint16(cn[16:], uint16(len(m)))
+		s.queue = append(s.queue, append(cn, m...))
+	}
+
+	id := w1[4:12]
+	cmds := w1[12:]
+	switch w1[0] {
+	case simListMasters:
+		reply(seq+1, simListMasters, make([]byte, 8), []byte{1, 0, 0, 0})
+		return nil
+	case simMasterCmd, simSlaveCmd:
+	default:
+		return errors.New("simulator: unsupported message type")
+	}
+
+	for len(cmds) >= 4 {
+		n := int(netlink.NativeEndian.Uint16(cmds[2:]))
+		cmd, arg := cmds[0], cmds[4:4+n]
+		cmds = cmds[4+n:]
+
+		switch cmd {
+		case simCmdListSlaves:
+			reply(seq+1, w1[0], id, append([]byte{simCmdListSlaves, 0, 8, 0}, s.rom...))
+		case simCmdWrite:
+			s.write(arg)
+		case simCmdRead:
+			out := make([]byte, n)
+			for i := range out {
+				out[i] = 0xFF
+				if len(s.stream) > 0 {
+					out[i] = s.stream[0]
+					s.stream = s.stream[1:]
+				}
+			}
+			body := []byte{simCmdRead, 0, 0, 0}
+			netlink.NativeEndian.PutUint16(body[2:], uint16(n))
+			reply(seq+1, w1[0], id, append(body, out...))
+		}
+
+		// status
+		reply(ack, w1[0], id, []byte{cmd, 0, 0, 0})
+	}
+
+	return nil
+}
+
+// write handles a DS1922L command and prepares its response stream
+func (s *simulator) write(arg []byte) {
+	s.stream = nil
+
+	switch arg[0] {
+	case readMemory:
+		address := int(arg[1]) + int(arg[2])<<8
+		for page := address; page < len(s.memory); page += 32 {
+			data := s.memory[page : page+32]
+			var crc uint16
+			if page == address {
+				crc = Checksum(append(append([]byte{}, arg[:3]...), data...))
+			} else {
+				crc = Checksum(data)
+			}
+			s.stream = append(s.stream, data...)
+			s.stream = append(s.stream, byte(^crc), byte(^crc>>8))
+		}
+	case readScratchpad:
+		// target address and a completed transfer status
+		s.stream = []byte{0x00, 0x02, 0x1F}
+	}
+}
+
+func (s *simulator) Receive() ([]byte, error) {
+	if len(s.queue) == 0 {
+		return nil, errors.New("simulator: nothing to receive")
+	}
+	data := s.queue[0]
+	s.queue = s.queue[1:]
+	return data, nil
+}
+
+func (s *simulator) Close() {}
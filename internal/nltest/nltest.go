@@ -0,0 +1,82 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package nltest provides helpers for the tests of the Netlink packages
+package nltest
+
+import (
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/endian"
+)
+
+// ByteOrders are the byte orders codecs are tested in
+var ByteOrders = []binary.ByteOrder{binary.LittleEndian, binary.BigEndian}
+
+// UseByteOrder makes the codecs use the given byte order until t and its
+// subtests are done
+func UseByteOrder(t testing.TB, order binary.ByteOrder) {
+	native := endian.Native
+	endian.Native = order
+	t.Cleanup(func() { endian.Native = native })
+}
+
+// Kernel is a netlink.Transport handing out recorded requests of the
+// kernel and collecting the replies. Receive returns io.EOF once all
+// requests are handed out.
+type Kernel struct {
+	Requests [][]byte
+	Replies  [][]byte
+}
+
+// Send collects a reply
+func (k *Kernel) Send(data []byte) error {
+	k.Replies = append(k.Replies, data)
+	return nil
+}
+
+// Receive hands out the next request
+func (k *Kernel) Receive() ([]byte, error) {
+	if len(k.Requests) == 0 {
+		return nil, io.EOF
+	}
+	data := k.Requests[0]
+	k.Requests = k.Requests[1:]
+	return data, nil
+}
+
+// Close does nothing
+func (k *Kernel) Close() {}
+
+// CbID is a connector.CbID, which this package cannot import as the tests
+// of connector use it
+type CbID interface {
+	Idx() uint32
+	Val() uint32
+}
+
+// CnMsg wraps data in a connector message of the given CbID
+func CnMsg(id CbID, seq uint32, data []byte) []byte {
+	bs := make([]byte, 20)
+	endian.Native.PutUint32(bs[0:], id.Idx())
+	endian.Native.PutUint32(bs[4:], id.Val())
+	endian.Native.PutUint32(bs[8:], seq)
+	endian.Native.PutUint16(bs[16:], uint16(len(data)))
+	return append(bs, data...)
+}
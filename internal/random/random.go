@@ -0,0 +1,37 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package random provides the initial sequence numbers of Netlink sockets
+// and Connectors
+package random
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// Uint32 returns a random number which differs between processes. Unlike
+// math/rand before Go 1.20, crypto/rand needs no seeding.
+func Uint32() uint32 {
+	var b [4]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return uint32(time.Now().UnixNano())
+	}
+	return binary.LittleEndian.Uint32(b[:])
+}
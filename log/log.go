@@ -34,7 +34,7 @@ func Printf(format string, v ...interface{}) {
 		return
 	}
 
-	log.Printf(format, v)
+	log.Printf(format, v...)
 }
 
 // Print log line. Same API as build-in log
@@ -43,5 +43,5 @@ func Print(v ...interface{}) {
 		return
 	}
 
-	log.Print(v)
+	log.Print(v...)
 }
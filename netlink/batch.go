@@ -0,0 +1,173 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+
+	"github.com/lambdasoup/go-netlink/log"
+)
+
+// from linux/socket.h
+const msgWaitForOne = 0x10000
+
+// mmsghdr is struct mmsghdr from linux/socket.h
+type mmsghdr struct {
+	hdr syscall.Msghdr
+	len uint32
+}
+
+// Queue adds a message of the given type and flags with the given data to
+// the batch sent by the next Flush, e.g. RTM_NEWROUTE with
+// NLM_F_REQUEST|NLM_F_CREATE|NLM_F_ACK for rtnetlink
+func (s *Socket) Queue(msgType uint16, flags uint16, data []byte) {
+	msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(data)), msgType, flags, s.seq, s.pid, data}
+	s.seq++
+	s.batch = append(s.batch, msg.Bytes())
+}
+
+// Flush sends all queued messages with as few sendmmsg calls as possible,
+// each in a datagram of its own, as protocols like connector only read the
+// first message of a datagram. Messages not sent because of an error stay
+// queued for the next Flush.
+func (s *Socket) Flush() error {
+	for len(s.batch) > 0 {
+		n, err := s.sendmmsg(s.batch)
+		for _, bs := range s.batch[:n] {
+			log.Printf("\t\t\tNL SEND: %v", &decoded{s.proto, bs})
+			if cerr := s.capture(Outgoing, bs); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		s.batch = s.batch[n:]
+		if err != nil {
+			return err
+		}
+	}
+	s.batch = nil
+	return nil
+}
+
+// sendmmsg sends the given datagrams with one system call and returns how
+// many of them were sent
+func (s *Socket) sendmmsg(datagrams [][]byte) (int, error) {
+	name := &syscall.RawSockaddrNetlink{Family: syscall.AF_NETLINK, Pid: s.lsa.Pid, Groups: s.lsa.Groups}
+	iovs := make([]syscall.Iovec, len(datagrams))
+	hdrs := make([]mmsghdr, len(datagrams))
+	for i, bs := range datagrams {
+		iovs[i].Base = &bs[0]
+		iovs[i].SetLen(len(bs))
+		hdrs[i].hdr.Name = (*byte)(unsafe.Pointer(name))
+		hdrs[i].hdr.Namelen = syscall.SizeofSockaddrNetlink
+		hdrs[i].hdr.Iov = &iovs[i]
+		setIovlen(&hdrs[i].hdr, 1)
+	}
+
+	n, _, errno := syscall.Syscall6(sysSendmmsg, uintptr(s.socketFd),
+		uintptr(unsafe.Pointer(&hdrs[0])), uintptr(len(hdrs)), 0, 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// ReceiveBatch drains up to max datagrams with a single recvmmsg call. It
+// blocks until at least one datagram arrives and returns the payloads of
+// all messages they carry. Messages left over by Receive are returned
+// first, without waiting for more.
+func (s *Socket) ReceiveBatch(max int) ([][]byte, error) {
+	if max < 1 {
+		return nil, errors.New("netlink: batch must hold at least one datagram")
+	}
+	if len(s.pending) > 0 {
+		payloads := s.pending
+		s.pending = nil
+		return payloads, nil
+	}
+
+	// the buffers are reused, the payloads are copied out of them
+	for len(s.bufs) < max {
+		s.bufs = append(s.bufs, make([]byte, receiveBufLen))
+	}
+	bufs := s.bufs[:max]
+	iovs := make([]syscall.Iovec, max)
+	hdrs := make([]mmsghdr, max)
+	for i := range hdrs {
+		iovs[i].Base = &bufs[i][0]
+		iovs[i].SetLen(receiveBufLen)
+		hdrs[i].hdr.Iov = &iovs[i]
+		setIovlen(&hdrs[i].hdr, 1)
+	}
+
+	n, _, errno := syscall.Syscall6(syscall.SYS_RECVMMSG, uintptr(s.socketFd),
+		uintptr(unsafe.Pointer(&hdrs[0])), uintptr(max), msgWaitForOne, 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	var payloads [][]byte
+	for i := 0; i < int(n); i++ {
+		datagram := bufs[i][:hdrs[i].len]
+		err := s.capture(Incoming, datagram)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("\t\t\tNL RECV: %v", &decoded{s.proto, datagram})
+
+		msgs, err := parseNetlinkMsgs(datagram)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			payloads = append(payloads, append([]byte(nil), msg.data...))
+		}
+	}
+	return payloads, nil
+}
+
+// parseNetlinkMsgs splits a datagram into its messages, of which there is
+// at least one
+func parseNetlinkMsgs(datagram []byte) ([]*netlinkMsg, error) {
+	var msgs []*netlinkMsg
+	for len(msgs) == 0 || len(datagram) >= syscall.NLMSG_HDRLEN {
+		l := len(datagram)
+		if l >= syscall.NLMSG_HDRLEN {
+			l = nlmsgAlign(int(NativeEndian.Uint32(datagram)))
+		}
+		if l < syscall.NLMSG_HDRLEN || l > len(datagram) {
+			l = len(datagram)
+		}
+		msg, err := parseNetlinkMsg(datagram[:l])
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+		datagram = datagram[l:]
+	}
+	return msgs, nil
+}
+
+// setIovlen sets the iovec count of h, whose type differs between
+// architectures like the one of Iovec.Len
+func setIovlen(h *syscall.Msghdr, n int) {
+	var iov syscall.Iovec
+	iov.SetLen(n)
+	h.Iovlen = iov.Len
+}
@@ -0,0 +1,100 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+// pair opens two Sockets, with s1 sending to s2 in place of the kernel
+func pair(t *testing.T) (*Socket, *Socket) {
+	s1, err := Open(syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		t.Skipf("could not open netlink socket: %v", err)
+	}
+	s2, err := Open(syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		s1.Close()
+		t.Fatalf("could not open second netlink socket: %v", err)
+	}
+	s1.lsa = &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Pid: s2.PortID()}
+	return s1, s2
+}
+
+func TestBatch(t *testing.T) {
+	s1, s2 := pair(t)
+	defer s1.Close()
+	defer s2.Close()
+
+	want := [][]byte{{1}, {2, 3, 4, 5, 6}, {7, 8, 9, 10}}
+	for _, data := range want {
+		s1.Queue(syscall.NLMSG_DONE, 0, data)
+	}
+	err := s1.Flush()
+	if err == syscall.EPERM {
+		t.Skipf("not allowed to send to user ports: %v", err)
+	}
+	assert(t, err == nil)
+	assert(t, len(s1.batch) == 0)
+
+	// one datagram per message
+	got, err := s2.ReceiveBatch(4)
+	assert(t, err == nil)
+	assert(t, len(got) == len(want))
+	for i := range want {
+		assert(t, bytes.Equal(got[i], want[i]))
+	}
+
+	// one datagram carrying all messages, returned alike by ReceiveBatch
+	// and Receive
+	var datagram []byte
+	for _, data := range want {
+		msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(data)), syscall.NLMSG_DONE, 0, 1, s1.pid, data}
+		datagram = append(datagram, msg.Bytes()...)
+		datagram = append(datagram, make([]byte, nlmsgAlign(len(datagram))-len(datagram))...)
+	}
+	for i := 0; i < 2; i++ {
+		assert(t, syscall.Sendto(s1.socketFd, datagram, 0, s1.lsa) == nil)
+	}
+	got, err = s2.ReceiveBatch(1)
+	assert(t, err == nil)
+	assert(t, len(got) == len(want))
+	for i := range want {
+		assert(t, bytes.Equal(got[i], want[i]))
+		data, err := s2.Receive()
+		assert(t, err == nil && bytes.Equal(data, want[i]))
+	}
+}
+
+func TestFlushError(t *testing.T) {
+	s1, s2 := pair(t)
+	defer s2.Close()
+
+	s1.Queue(syscall.NLMSG_DONE, 0, []byte{1})
+	s1.Close()
+	// the message stays queued
+	assert(t, s1.Flush() != nil)
+	assert(t, len(s1.batch) == 1)
+}
+
+func TestReceiveBatchEmpty(t *testing.T) {
+	_, err := (&Socket{}).ReceiveBatch(0)
+	assert(t, err != nil)
+}
@@ -0,0 +1,242 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// Node is an element of a decoded message tree
+type Node struct {
+	Name     string
+	Value    string
+	Children []*Node
+}
+
+// Add appends a child with the given name and formatted value to n
+func (n *Node) Add(name string, format string, a ...interface{}) *Node {
+	c := &Node{Name: name, Value: fmt.Sprintf(format, a...)}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// AddHex appends a hexdump of data to n
+func (n *Node) AddHex(name string, data []byte) *Node {
+	c := n.Add(name, "%d bytes", len(data))
+	for i := 0; i < len(data); i += 16 {
+		end := i + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		line := data[i:end]
+
+		ascii := make([]byte, len(line))
+		for j, b := range line {
+			if b < 0x20 || b > 0x7e {
+				b = '.'
+			}
+			ascii[j] = b
+		}
+		c.Add(fmt.Sprintf("%04x", i), "%-47s  |%s|", fmt.Sprintf("% x", line), ascii)
+	}
+	return c
+}
+
+// String renders the tree below n, one indented line per Node
+func (n *Node) String() string {
+	buf := new(bytes.Buffer)
+	n.write(buf, 0)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (n *Node) write(buf *bytes.Buffer, depth int) {
+	buf.WriteString(strings.Repeat("  ", depth))
+	buf.WriteString(n.Name)
+	if n.Value != "" {
+		buf.WriteString(": ")
+		buf.WriteString(n.Value)
+	}
+	buf.WriteString("\n")
+	for _, c := range n.Children {
+		c.write(buf, depth+1)
+	}
+}
+
+// PayloadDecoder decodes the payload of a Netlink message of the given type
+// into n. Decoders must not trust the payload to be well formed.
+type PayloadDecoder func(n *Node, msgType uint16, payload []byte)
+
+var decoders = map[int]PayloadDecoder{}
+
+// RegisterDecoder installs the PayloadDecoder for the given Netlink protocol.
+// Higher layer packages register themselves when they are linked in.
+func RegisterDecoder(proto int, d PayloadDecoder) {
+	decoders[proto] = d
+}
+
+// Decode renders a datagram of the given Netlink protocol as message tree.
+// Payloads of protocols without a registered decoder are hexdumped.
+func Decode(proto int, datagram []byte) *Node {
+	root := &Node{Name: "datagram", Value: fmt.Sprintf("%d bytes", len(datagram))}
+
+	for len(datagram) > 0 {
+		if len(datagram) < syscall.NLMSG_HDRLEN {
+			root.AddHex("truncated", datagram)
+			break
+		}
+
+		l := NativeEndian.Uint32(datagram[0:])
+		msgType := NativeEndian.Uint16(datagram[4:])
+		flags := NativeEndian.Uint16(datagram[6:])
+
+		n := root.Add("netlink", "%s", msgTypeName(proto, msgType))
+		n.Add("len", "%d", l)
+		n.Add("flags", "%s", flagNames(proto, msgType, flags))
+		n.Add("seq", "%d", NativeEndian.Uint32(datagram[8:]))
+		n.Add("port", "%d", NativeEndian.Uint32(datagram[12:]))
+
+		if l < syscall.NLMSG_HDRLEN || int(l) > len(datagram) {
+			n.AddHex("invalid length", datagram[syscall.NLMSG_HDRLEN:])
+			break
+		}
+		payload := datagram[syscall.NLMSG_HDRLEN:l]
+
+		switch {
+		case msgType == syscall.NLMSG_ERROR:
+			decodeError(n, payload)
+		case decoders[proto] != nil:
+			// some protocols such as Connector carry data in NLMSG_DONE
+			decoders[proto](n, msgType, payload)
+		case len(payload) > 0:
+			n.AddHex("payload", payload)
+		}
+
+		next := nlmsgAlign(int(l))
+		if next > len(datagram) {
+			break
+		}
+		datagram = datagram[next:]
+	}
+
+	return root
+}
+
+func nlmsgAlign(l int) int {
+	return (l + syscall.NLMSG_ALIGNTO - 1) &^ (syscall.NLMSG_ALIGNTO - 1)
+}
+
+func decodeError(n *Node, payload []byte) {
+	if len(payload) < 4 {
+		n.AddHex("truncated", payload)
+		return
+	}
+	code := int32(NativeEndian.Uint32(payload))
+	if code == 0 {
+		n.Add("error", "0 (ack)")
+	} else {
+		n.Add("error", "%d (%v)", code, syscall.Errno(-code))
+	}
+	if len(payload) >= 4+syscall.NLMSG_HDRLEN {
+		orig := n.Add("request", "")
+		orig.Add("len", "%d", NativeEndian.Uint32(payload[4:]))
+		orig.Add("type", "%d", NativeEndian.Uint16(payload[8:]))
+		orig.Add("seq", "%d", NativeEndian.Uint32(payload[12:]))
+		orig.Add("port", "%d", NativeEndian.Uint32(payload[16:]))
+	}
+}
+
+// from linux/netlink.h
+var msgTypeNames = map[uint16]string{
+	syscall.NLMSG_NOOP:    "NLMSG_NOOP",
+	syscall.NLMSG_ERROR:   "NLMSG_ERROR",
+	syscall.NLMSG_DONE:    "NLMSG_DONE",
+	syscall.NLMSG_OVERRUN: "NLMSG_OVERRUN",
+}
+
+func msgTypeName(proto int, msgType uint16) string {
+	if name, ok := msgTypeNames[msgType]; ok {
+		return name
+	}
+	if proto == syscall.NETLINK_ROUTE {
+		if name := rtmName(msgType); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("type %d", msgType)
+}
+
+type flagName struct {
+	flag uint16
+	name string
+}
+
+// from linux/netlink.h
+var (
+	commonFlags = []flagName{
+		{syscall.NLM_F_REQUEST, "REQUEST"},
+		{syscall.NLM_F_MULTI, "MULTI"},
+		{syscall.NLM_F_ACK, "ACK"},
+		{syscall.NLM_F_ECHO, "ECHO"},
+		{0x10, "DUMP_INTR"},
+		{0x20, "DUMP_FILTERED"},
+	}
+	getFlags = []flagName{
+		{syscall.NLM_F_ROOT, "ROOT"},
+		{syscall.NLM_F_MATCH, "MATCH"},
+		{syscall.NLM_F_ATOMIC, "ATOMIC"},
+	}
+	newFlags = []flagName{
+		{syscall.NLM_F_REPLACE, "REPLACE"},
+		{syscall.NLM_F_EXCL, "EXCL"},
+		{syscall.NLM_F_CREATE, "CREATE"},
+		{syscall.NLM_F_APPEND, "APPEND"},
+	}
+)
+
+// flagNames renders Netlink header flags. The meaning of the upper byte
+// depends on the request, it is only named for rtnetlink.
+func flagNames(proto int, msgType uint16, flags uint16) string {
+	table := commonFlags
+	if proto == syscall.NETLINK_ROUTE && msgType >= syscall.RTM_BASE {
+		switch (msgType - syscall.RTM_BASE) % 4 {
+		case 0:
+			table = append(append([]flagName{}, commonFlags...), newFlags...)
+		case 2:
+			table = append(append([]flagName{}, commonFlags...), getFlags...)
+		}
+	}
+
+	var names []string
+	rest := flags
+	for _, f := range table {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+			rest &^= f.flag
+		}
+	}
+	if rest != 0 {
+		names = append(names, fmt.Sprintf("%#x", rest))
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%#x (%s)", flags, strings.Join(names, "|"))
+}
@@ -0,0 +1,89 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"encoding/binary"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+)
+
+func TestDecodeError(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	payload := []byte{0xfe, 0xff, 0xff, 0xff}
+	orig := &netlinkMsg{syscall.NLMSG_HDRLEN, syscall.RTM_GETLINK, syscall.NLM_F_REQUEST | syscall.NLM_F_ACK, 7, 0, nil}
+	payload = append(payload, orig.Bytes()...)
+	msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(payload)), syscall.NLMSG_ERROR, 0, 7, 4711, payload}
+
+	s := Decode(syscall.NETLINK_ROUTE, msg.Bytes()).String()
+	t.Log(s)
+
+	assert(t, strings.Contains(s, "netlink: NLMSG_ERROR"))
+	assert(t, strings.Contains(s, "error: -2 (no such file or directory)"))
+	assert(t, strings.Contains(s, "port: 4711"))
+}
+
+func TestDecodeRoute(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	// ifinfomsg followed by IFLA_IFNAME "lo" and IFLA_MTU 65536
+	payload := make([]byte, 16)
+	payload = append(payload, 7, 0, syscall.IFLA_IFNAME, 0, 'l', 'o', 0, 0)
+	payload = append(payload, 8, 0, syscall.IFLA_MTU, 0, 0, 0, 1, 0)
+	flags := uint16(syscall.NLM_F_REQUEST | syscall.NLM_F_CREATE | syscall.NLM_F_EXCL)
+	msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(payload)), syscall.RTM_NEWLINK, flags, 1, 0, payload}
+
+	s := Decode(syscall.NETLINK_ROUTE, msg.Bytes()).String()
+	t.Log(s)
+
+	assert(t, strings.Contains(s, "netlink: RTM_NEWLINK"))
+	assert(t, strings.Contains(s, "flags: 0x601 (REQUEST|EXCL|CREATE)"))
+	assert(t, strings.Contains(s, `IFLA_IFNAME: "lo"`))
+	assert(t, strings.Contains(s, "IFLA_MTU: 65536"))
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	// declared length beyond the datagram
+	msg := &netlinkMsg{200, syscall.RTM_NEWADDR, 0, 1, 0, []byte{1, 2, 3}}
+	s := Decode(syscall.NETLINK_ROUTE, msg.Bytes()).String()
+	assert(t, strings.Contains(s, "invalid length"))
+
+	// every truncation of a valid message must decode without panicking
+	payload := make([]byte, 8)
+	payload = append(payload, 8, 0, syscall.IFA_ADDRESS, 0, 127, 0, 0, 1)
+	bs := (&netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(payload)), syscall.RTM_NEWADDR, 0, 1, 0, payload}).Bytes()
+	for i := range bs {
+		Decode(syscall.NETLINK_ROUTE, bs[:i])
+	}
+	assert(t, strings.Contains(Decode(syscall.NETLINK_ROUTE, bs).String(), "IFA_ADDRESS: 127.0.0.1"))
+}
+
+func FuzzDecode(f *testing.F) {
+	payload := make([]byte, 16)
+	payload = append(payload, 7, 0, syscall.IFLA_IFNAME, 0, 'l', 'o', 0, 0)
+	f.Add((&netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(payload)), syscall.RTM_NEWLINK, 0, 1, 0, payload}).Bytes())
+	f.Fuzz(func(t *testing.T, datagram []byte) {
+		_ = Decode(syscall.NETLINK_ROUTE, datagram).String()
+	})
+}
@@ -0,0 +1,43 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import "github.com/lambdasoup/go-netlink/internal/endian"
+
+// NativeEndian is the byte order of the host. Netlink headers and the
+// payloads of most protocols are encoded in it, rather than in network
+// byte order.
+var NativeEndian nativeEndian
+
+// nativeEndian is a binary.ByteOrder which follows the host, or the byte
+// order the tests of this module switched to
+type nativeEndian struct{}
+
+func (nativeEndian) Uint16(b []byte) uint16 { return endian.Native.Uint16(b) }
+
+func (nativeEndian) Uint32(b []byte) uint32 { return endian.Native.Uint32(b) }
+
+func (nativeEndian) Uint64(b []byte) uint64 { return endian.Native.Uint64(b) }
+
+func (nativeEndian) PutUint16(b []byte, v uint16) { endian.Native.PutUint16(b, v) }
+
+func (nativeEndian) PutUint32(b []byte, v uint32) { endian.Native.PutUint32(b, v) }
+
+func (nativeEndian) PutUint64(b []byte, v uint64) { endian.Native.PutUint64(b, v) }
+
+func (nativeEndian) String() string { return endian.Native.String() }
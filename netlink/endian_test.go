@@ -0,0 +1,60 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"bytes"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+)
+
+func TestByteOrders(t *testing.T) {
+	for _, order := range nltest.ByteOrders {
+		t.Run(order.String(), func(t *testing.T) {
+			nltest.UseByteOrder(t, order)
+
+			data := []byte{1, 2, 3}
+			msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(data)), syscall.NLMSG_DONE, syscall.NLM_F_MULTI, 12345, 4711, data}
+			bs := msg.Bytes()
+
+			hdr := make([]byte, syscall.NLMSG_HDRLEN)
+			order.PutUint32(hdr[0:], 19)
+			order.PutUint16(hdr[4:], syscall.NLMSG_DONE)
+			order.PutUint16(hdr[6:], syscall.NLM_F_MULTI)
+			order.PutUint32(hdr[8:], 12345)
+			order.PutUint32(hdr[12:], 4711)
+			assert(t, bytes.Equal(bs[:syscall.NLMSG_HDRLEN], hdr))
+
+			parsed, err := parseNetlinkMsg(bs)
+			assert(t, err == nil)
+			assert(t, parsed.len == msg.len)
+			assert(t, parsed.msgType == msg.msgType)
+			assert(t, parsed.flags == msg.flags)
+			assert(t, parsed.seq == msg.seq)
+			assert(t, parsed.pid == msg.pid)
+			assert(t, bytes.Equal(parsed.data, data))
+
+			s := Decode(syscall.NETLINK_ROUTE, bs).String()
+			assert(t, strings.Contains(s, "seq: 12345"))
+			assert(t, strings.Contains(s, "port: 4711"))
+		})
+	}
+}
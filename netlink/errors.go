@@ -0,0 +1,55 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Causes of a ParseError, to be tested for with errors.Is
+var (
+	// ErrShortMessage means the buffer ends before the header or the data
+	// it declares
+	ErrShortMessage = errors.New("short message")
+	// ErrInvalidLength means a declared length is impossible, such as one
+	// shorter than the header it is part of
+	ErrInvalidLength = errors.New("invalid length")
+	// ErrTrailingData means bytes are left over after the message
+	ErrTrailingData = errors.New("trailing data")
+)
+
+// ParseError describes a message which does not fit its buffer. It is
+// returned by the parsers of all layers.
+type ParseError struct {
+	// Layer names the protocol, such as "netlink", "connector" or "w1"
+	Layer string
+	// Err is one of ErrShortMessage, ErrInvalidLength or ErrTrailingData
+	Err error
+	// Want is the length the message requires, Have the bytes available
+	Want, Have int
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %v: want %d bytes, have %d", e.Layer, e.Err, e.Want, e.Have)
+}
+
+// Unwrap returns the cause of the error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
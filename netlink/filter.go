@@ -0,0 +1,148 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Netlink header field offsets, from linux/netlink.h
+const (
+	nlmsgTypeOffset = 4
+	nlmsgPidOffset  = 12
+)
+
+// accept everything the kernel hands to the filter
+const filterAcceptAll = 0xffffffff
+
+// Filter is a classic BPF program which the kernel runs on every datagram
+// before queueing it on a Socket. Rejected datagrams never reach userspace.
+// Filters only inspect the first Netlink message of a datagram.
+type Filter []syscall.SockFilter
+
+// Match tests a single header field of a datagram. It holds if the Size
+// bytes wide field at Offset bytes from the start of the Netlink header
+// equals one of Values. Values are given in host byte order, at most 255
+// of them per Match.
+type Match struct {
+	Offset uint32
+	Size   int
+	Values []uint32
+}
+
+// MsgTypeMatch matches datagrams of the given Netlink message types
+func MsgTypeMatch(types ...uint16) Match {
+	values := make([]uint32, len(types))
+	for i, t := range types {
+		values[i] = uint32(t)
+	}
+	return Match{nlmsgTypeOffset, 2, values}
+}
+
+// PortMatch matches datagrams sent from port 0 or the given port. The
+// Netlink header holds the sender's port: replies of the kernel carry 0,
+// its notifications often the port of the process which caused them.
+func PortMatch(port uint32) Match {
+	return Match{nlmsgPidOffset, 4, []uint32{0, port}}
+}
+
+// NewFilter builds a Filter which accepts datagrams for which all of the
+// given matches hold and drops all others
+func NewFilter(matches ...Match) (Filter, error) {
+	var f Filter
+
+	for _, m := range matches {
+		// jump offsets are 8 bits wide
+		if len(m.Values) > 255 {
+			return nil, fmt.Errorf("netlink: filter match of %d values exceeds the maximum of 255", len(m.Values))
+		}
+		size, err := loadSize(m.Size)
+		if err != nil {
+			return nil, err
+		}
+		f = append(f, syscall.SockFilter{Code: syscall.BPF_LD | size | syscall.BPF_ABS, K: m.Offset})
+
+		// on equality skip the remaining comparisons and the reject
+		for i, v := range m.Values {
+			jt := uint8(len(m.Values) - i)
+			f = append(f, syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: jt, K: wireValue(v, m.Size)})
+		}
+		f = append(f, syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: 0})
+	}
+
+	f = append(f, syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: filterAcceptAll})
+
+	return f, nil
+}
+
+// loadSize returns the BPF load width for a field of the given size
+func loadSize(size int) (uint16, error) {
+	switch size {
+	case 1:
+		return syscall.BPF_B, nil
+	case 2:
+		return syscall.BPF_H, nil
+	case 4:
+		return syscall.BPF_W, nil
+	}
+	return 0, fmt.Errorf("netlink: filter field size %d is not 1, 2 or 4", size)
+}
+
+// wireValue converts a host order value to what a BPF load of the field
+// yields. BPF loads are always done in network byte order.
+func wireValue(v uint32, size int) uint32 {
+	bs := make([]byte, 4)
+	switch size {
+	case 1:
+		return v & 0xff
+	case 2:
+		NativeEndian.PutUint16(bs, uint16(v))
+		return uint32(binary.BigEndian.Uint16(bs))
+	}
+	NativeEndian.PutUint32(bs, v)
+	return binary.BigEndian.Uint32(bs)
+}
+
+// SetFilter attaches the given Filter to this Socket, replacing any
+// previously attached one
+func (s *Socket) SetFilter(f Filter) error {
+	if len(f) == 0 {
+		return syscall.EINVAL
+	}
+	prog := syscall.SockFprog{
+		Len:    uint16(len(f)),
+		Filter: &f[0],
+	}
+	return setsockopt(s.socketFd, syscall.SOL_SOCKET, syscall.SO_ATTACH_FILTER, unsafe.Pointer(&prog), unsafe.Sizeof(prog))
+}
+
+// RemoveFilter detaches the Filter from this Socket
+func (s *Socket) RemoveFilter() error {
+	return syscall.SetsockoptInt(s.socketFd, syscall.SOL_SOCKET, syscall.SO_DETACH_FILTER, 0)
+}
+
+func setsockopt(fd, level, opt int, val unsafe.Pointer, size uintptr) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd), uintptr(level), uintptr(opt), uintptr(val), size, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
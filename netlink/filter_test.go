@@ -0,0 +1,123 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+)
+
+func TestMsgTypeFilter(t *testing.T) {
+	f, err := NewFilter(MsgTypeMatch(syscall.NLMSG_DONE, syscall.NLMSG_ERROR))
+	assert(t, err == nil)
+
+	done := &netlinkMsg{syscall.NLMSG_HDRLEN, syscall.NLMSG_DONE, 0, 1, 0, nil}
+	errMsg := &netlinkMsg{syscall.NLMSG_HDRLEN, syscall.NLMSG_ERROR, 0, 1, 0, nil}
+	noop := &netlinkMsg{syscall.NLMSG_HDRLEN, syscall.NLMSG_NOOP, 0, 1, 0, nil}
+
+	assert(t, runFilter(f, done.Bytes()))
+	assert(t, runFilter(f, errMsg.Bytes()))
+	assert(t, !runFilter(f, noop.Bytes()))
+
+	// loads beyond the datagram reject it
+	assert(t, !runFilter(f, []byte{16, 0, 0, 0}))
+}
+
+func TestPayloadFilter(t *testing.T) {
+	for _, order := range nltest.ByteOrders {
+		t.Run(order.String(), func(t *testing.T) {
+			nltest.UseByteOrder(t, order)
+
+			f, err := NewFilter(
+				MsgTypeMatch(syscall.NLMSG_DONE),
+				Match{Offset: syscall.NLMSG_HDRLEN, Size: 4, Values: []uint32{3}},
+				Match{Offset: syscall.NLMSG_HDRLEN + 4, Size: 4, Values: []uint32{1}},
+			)
+			assert(t, err == nil)
+
+			payload := make([]byte, 8)
+			order.PutUint32(payload[0:], 3)
+			order.PutUint32(payload[4:], 1)
+			msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(payload)), syscall.NLMSG_DONE, 0, 1, 0, payload}
+			assert(t, runFilter(f, msg.Bytes()))
+
+			order.PutUint32(payload[4:], 2)
+			assert(t, !runFilter(f, msg.Bytes()))
+		})
+	}
+}
+
+func TestPortFilter(t *testing.T) {
+	f, err := NewFilter(PortMatch(4711))
+	assert(t, err == nil)
+
+	kernel := &netlinkMsg{syscall.NLMSG_HDRLEN, syscall.NLMSG_DONE, 0, 1, 0, nil}
+	own := &netlinkMsg{syscall.NLMSG_HDRLEN, syscall.NLMSG_DONE, 0, 1, 4711, nil}
+	other := &netlinkMsg{syscall.NLMSG_HDRLEN, syscall.NLMSG_DONE, 0, 1, 4712, nil}
+
+	assert(t, runFilter(f, kernel.Bytes()))
+	assert(t, runFilter(f, own.Bytes()))
+	assert(t, !runFilter(f, other.Bytes()))
+}
+
+func TestFilterInvalid(t *testing.T) {
+	_, err := NewFilter(Match{Offset: 0, Size: 3, Values: []uint32{1}})
+	assert(t, err != nil)
+	_, err = NewFilter(Match{Offset: 0, Size: 4, Values: make([]uint32, 256)})
+	assert(t, err != nil)
+}
+
+// runFilter interprets the subset of classic BPF emitted by NewFilter and
+// reports whether the datagram is accepted
+func runFilter(f Filter, data []byte) bool {
+	var a uint32
+	for pc := 0; pc < len(f); pc++ {
+		ins := f[pc]
+		switch ins.Code {
+		case syscall.BPF_LD | syscall.BPF_B | syscall.BPF_ABS:
+			if int(ins.K)+1 > len(data) {
+				return false
+			}
+			a = uint32(data[ins.K])
+		case syscall.BPF_LD | syscall.BPF_H | syscall.BPF_ABS:
+			if int(ins.K)+2 > len(data) {
+				return false
+			}
+			a = uint32(binary.BigEndian.Uint16(data[ins.K:]))
+		case syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS:
+			if int(ins.K)+4 > len(data) {
+				return false
+			}
+			a = binary.BigEndian.Uint32(data[ins.K:])
+		case syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K:
+			if a == ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case syscall.BPF_RET | syscall.BPF_K:
+			return ins.K != 0
+		default:
+			panic("unsupported instruction")
+		}
+	}
+	return false
+}
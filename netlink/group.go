@@ -0,0 +1,44 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"syscall"
+	"time"
+)
+
+// from linux/socket.h, missing in package syscall
+const solNetlink = 270
+
+// JoinGroup subscribes this Socket to the given multicast group. Groups
+// are numbered from 1, joining most of them requires CAP_NET_ADMIN.
+func (s *Socket) JoinGroup(group uint32) error {
+	return syscall.SetsockoptInt(s.socketFd, solNetlink, syscall.NETLINK_ADD_MEMBERSHIP, int(group))
+}
+
+// LeaveGroup unsubscribes this Socket from the given multicast group
+func (s *Socket) LeaveGroup(group uint32) error {
+	return syscall.SetsockoptInt(s.socketFd, solNetlink, syscall.NETLINK_DROP_MEMBERSHIP, int(group))
+}
+
+// SetReceiveTimeout bounds how long Receive blocks. It then fails with
+// syscall.EAGAIN. A zero duration blocks forever.
+func (s *Socket) SetReceiveTimeout(d time.Duration) error {
+	tv := syscall.NsecToTimeval(d.Nanoseconds())
+	return syscall.SetsockoptTimeval(s.socketFd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+}
@@ -0,0 +1,54 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestJoinGroup(t *testing.T) {
+	s, err := Open(syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		t.Skipf("could not open netlink socket: %v", err)
+	}
+	defer s.Close()
+
+	// the w1 group of the Connector
+	err = s.JoinGroup(3)
+	if err == syscall.EPERM {
+		t.Skipf("not allowed to join groups: %v", err)
+	}
+	assert(t, err == nil)
+	assert(t, s.LeaveGroup(3) == nil)
+}
+
+func TestReceiveTimeout(t *testing.T) {
+	s, err := Open(syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		t.Skipf("could not open netlink socket: %v", err)
+	}
+	defer s.Close()
+
+	assert(t, s.SetReceiveTimeout(10*time.Millisecond) == nil)
+	start := time.Now()
+	_, err = s.Receive()
+	assert(t, err == syscall.EAGAIN)
+	assert(t, time.Since(start) < time.Second)
+}
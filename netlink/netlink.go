@@ -19,16 +19,17 @@
 package netlink
 
 import (
-	"bytes"
-	"encoding/binary"
-	"errors"
 	"fmt"
-	"os"
 	"syscall"
+	"time"
 
+	"github.com/lambdasoup/go-netlink/internal/random"
 	"github.com/lambdasoup/go-netlink/log"
 )
 
+// size of the receive buffer for a single datagram
+const receiveBufLen = 8192
+
 type netlinkMsg struct {
 	len     uint32
 	msgType uint16
@@ -38,17 +39,36 @@ type netlinkMsg struct {
 	data    []byte
 }
 
+// Transport sends and receives Netlink message payloads. Socket is the
+// kernel backed Transport, other implementations can stand in for the
+// kernel in tests.
+type Transport interface {
+	Send(data []byte) error
+	Receive() ([]byte, error)
+	Close()
+}
+
 // Socket is a Linux Netlink socket
 type Socket struct {
 	socketFd int
 	lsa      *syscall.SockaddrNetlink
 	seq      uint32
+	pid      uint32
+	proto    int
+	tap      PacketWriter
+	// messages queued for Flush
+	batch [][]byte
+	// datagram buffers of ReceiveBatch
+	bufs [][]byte
+	// received but not yet returned messages of a datagram
+	pending [][]byte
 }
 
-// Open creates and binds a new Netlink socket
-func Open() (*Socket, error) {
-	// TODO remove Connector hardcode
-	socketFd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM, syscall.NETLINK_CONNECTOR)
+// Open creates and binds a new Netlink socket of the given protocol, e.g.
+// syscall.NETLINK_CONNECTOR. The socket's port ID is assigned by the
+// kernel, so a process may open any number of sockets.
+func Open(proto int) (*Socket, error) {
+	socketFd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM, proto)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +77,54 @@ func Open() (*Socket, error) {
 	lsa.Family = syscall.AF_NETLINK
 	lsa.Pid = 0
 	err = syscall.Bind(socketFd, lsa)
-	return &Socket{socketFd, lsa, 0xaffe}, err
+	if err != nil {
+		syscall.Close(socketFd)
+		return nil, err
+	}
+
+	// read back the port ID the kernel assigned on bind
+	sa, err := syscall.Getsockname(socketFd)
+	if err != nil {
+		syscall.Close(socketFd)
+		return nil, err
+	}
+	nsa, ok := sa.(*syscall.SockaddrNetlink)
+	if !ok {
+		syscall.Close(socketFd)
+		return nil, fmt.Errorf("unexpected socket address %T", sa)
+	}
+
+	// a random first sequence number keeps restarted processes from
+	// matching replies meant for their predecessor
+	return &Socket{socketFd: socketFd, lsa: lsa, seq: random.Uint32(), pid: nsa.Pid, proto: proto}, nil
+}
+
+// PortID returns the kernel assigned Netlink port ID of this Socket
+func (s *Socket) PortID() uint32 {
+	return s.pid
+}
+
+// Tap copies every datagram sent or received on this Socket to the given
+// capture. A nil PacketWriter stops capturing.
+func (s *Socket) Tap(w PacketWriter) {
+	s.tap = w
+}
+
+func (s *Socket) capture(dir Direction, datagram []byte) error {
+	if s.tap == nil {
+		return nil
+	}
+	return s.tap.WritePacket(&Packet{time.Now(), dir, uint16(s.proto), datagram})
+}
+
+// decoded renders a datagram as message tree, only once it is printed
+type decoded struct {
+	proto    int
+	datagram []byte
+}
+
+func (d *decoded) String() string {
+	return "\n" + Decode(d.proto, d.datagram).String()
 }
 
 // Close this Socket's connection
@@ -68,28 +135,65 @@ func (s *Socket) Close() {
 // Send the given data through this Netlink connection
 func (s *Socket) Send(data []byte) error {
 	// TODO remove magic numbers
-	msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(data)), syscall.NLMSG_DONE, 0, s.seq, uint32(os.Getpid()), data}
+	msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(data)), syscall.NLMSG_DONE, 0, s.seq, s.pid, data}
 	s.seq++
 
-	log.Printf("\t\t\tNL SEND: %v", msg)
+	bs := msg.Bytes()
+	log.Printf("\t\t\tNL SEND: %v", &decoded{s.proto, bs})
+
+	err := s.capture(Outgoing, bs)
+	if err != nil {
+		return err
+	}
 
 	// TODO remove magic number
-	err := syscall.Sendto(s.socketFd, msg.Bytes(), 0, s.lsa)
+	err = syscall.Sendto(s.socketFd, bs, 0, s.lsa)
 	return err
 }
 
-func (msg *netlinkMsg) Bytes() []byte {
-	buf := new(bytes.Buffer)
+// AppendBinary appends the wire format of msg to b
+func (msg *netlinkMsg) AppendBinary(b []byte) ([]byte, error) {
+	n := len(b)
+	b = append(b, make([]byte, syscall.NLMSG_HDRLEN)...)
+	NativeEndian.PutUint32(b[n:], msg.len)
+	NativeEndian.PutUint16(b[n+4:], msg.msgType)
+	NativeEndian.PutUint16(b[n+6:], msg.flags)
+	NativeEndian.PutUint32(b[n+8:], msg.seq)
+	NativeEndian.PutUint32(b[n+12:], msg.pid)
+	return append(b, msg.data...), nil
+}
 
-	binary.Write(buf, binary.LittleEndian, msg.len)
-	binary.Write(buf, binary.LittleEndian, msg.msgType)
-	binary.Write(buf, binary.LittleEndian, msg.flags)
-	binary.Write(buf, binary.LittleEndian, msg.seq)
-	binary.Write(buf, binary.LittleEndian, msg.pid)
+// MarshalBinary returns the wire format of msg
+func (msg *netlinkMsg) MarshalBinary() ([]byte, error) {
+	return msg.AppendBinary(make([]byte, 0, syscall.NLMSG_HDRLEN+len(msg.data)))
+}
 
-	buf.Write(msg.data)
+// Bytes returns the wire format of msg
+func (msg *netlinkMsg) Bytes() []byte {
+	bs, _ := msg.MarshalBinary()
+	return bs
+}
+
+// UnmarshalBinary reads a message from the start of bs. The message's data
+// refers to bs and is not copied.
+func (msg *netlinkMsg) UnmarshalBinary(bs []byte) error {
+	if len(bs) < syscall.NLMSG_HDRLEN {
+		return &ParseError{"netlink", ErrShortMessage, syscall.NLMSG_HDRLEN, len(bs)}
+	}
+	msg.len = NativeEndian.Uint32(bs[0:])
+	msg.msgType = NativeEndian.Uint16(bs[4:])
+	msg.flags = NativeEndian.Uint16(bs[6:])
+	msg.seq = NativeEndian.Uint32(bs[8:])
+	msg.pid = NativeEndian.Uint32(bs[12:])
 
-	return buf.Bytes()
+	if msg.len < syscall.NLMSG_HDRLEN {
+		return &ParseError{"netlink", ErrInvalidLength, syscall.NLMSG_HDRLEN, int(msg.len)}
+	}
+	if uint64(msg.len) > uint64(len(bs)) {
+		return &ParseError{"netlink", ErrShortMessage, int(msg.len), len(bs)}
+	}
+	msg.data = bs[syscall.NLMSG_HDRLEN:msg.len]
+	return nil
 }
 
 func (msg *netlinkMsg) String() string {
@@ -106,48 +210,47 @@ func (msg *netlinkMsg) String() string {
 		msg.len, msgTypes[msg.msgType], msg.flags, msg.seq, msg.pid, len(msg.data))
 }
 
-// Receive data from this Netlink connection
+// Receive data from this Netlink connection. The messages of a datagram
+// carrying several are returned one per call.
 func (s *Socket) Receive() ([]byte, error) {
-	// TODO remove magic numbers
-	rb := make([]byte, 8192)
-	_, _, err := syscall.Recvfrom(s.socketFd, rb, 0)
-	if err != nil {
-		return nil, err
-	}
+	if len(s.pending) == 0 {
+		rb := make([]byte, receiveBufLen)
+		n, _, err := syscall.Recvfrom(s.socketFd, rb, 0)
+		if err != nil {
+			return nil, err
+		}
+		err = s.capture(Incoming, rb[:n])
+		if err != nil {
+			return nil, err
+		}
 
-	msg, err := parseNetlinkMsg(rb)
-	log.Printf("\t\t\tNL RECV: %v", msg)
-	return msg.data, err
+		log.Printf("\t\t\tNL RECV: %v", &decoded{s.proto, rb[:n]})
+		msgs, err := parseNetlinkMsgs(rb[:n])
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			s.pending = append(s.pending, msg.data)
+		}
+	}
+	data := s.pending[0]
+	s.pending = s.pending[1:]
+	return data, nil
 }
 
 func parseNetlinkMsg(bs []byte) (*netlinkMsg, error) {
 	msg := &netlinkMsg{}
-	buf := bytes.NewBuffer(bs)
-
-	err := error(nil)
-	err = binary.Read(buf, binary.LittleEndian, &msg.len)
-	err = binary.Read(buf, binary.LittleEndian, &msg.msgType)
-	err = binary.Read(buf, binary.LittleEndian, &msg.flags)
-	err = binary.Read(buf, binary.LittleEndian, &msg.seq)
-	err = binary.Read(buf, binary.LittleEndian, &msg.pid)
-
-	msg.data = make([]byte, msg.len-syscall.NLMSG_HDRLEN)
-
-	_, err = buf.Read(msg.data)
+	err := msg.UnmarshalBinary(bs)
+	if err != nil {
+		return nil, err
+	}
 
-	// check for truncated data
-	for {
-		bs := make([]byte, 1)
-		_, eof := buf.Read(bs)
-		if eof != nil {
-			break
-		}
-		if bs[0] == 0 {
-			continue
+	// check for truncated data, only alignment padding may follow
+	for _, b := range bs[msg.len:] {
+		if b != 0 {
+			return nil, &ParseError{"netlink", ErrTrailingData, int(msg.len), len(bs)}
 		}
-
-		err = errors.New("NL parse left truncated data")
 	}
 
-	return msg, err
+	return msg, nil
 }
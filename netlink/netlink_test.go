@@ -18,15 +18,22 @@
 package netlink
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"syscall"
 	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
 )
 
 func TestParseNetlinkMessage(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
 	var bs []byte
 
 	// length
-	bs = append(bs, 47, 0, 0, 0)
+	bs = append(bs, 46, 0, 0, 0)
 	// type, flags
 	bs = append(bs, 3, 0, 0, 0)
 	// seq, pid
@@ -37,9 +44,10 @@ func TestParseNetlinkMessage(t *testing.T) {
 	bs = append(bs, 58, 48, 0, 0, 11, 0, 0, 0)
 	bs = append(bs, 116, 101, 115, 116, 32, 114, 101, 112, 108, 121)
 
-	msg, _ := parseNetlinkMsg(bs)
+	msg, err := parseNetlinkMsg(bs)
 
-	assert(t, msg.len == uint32(47))
+	assert(t, err == nil)
+	assert(t, msg.len == uint32(46))
 	assert(t, msg.msgType == syscall.NLMSG_DONE)
 	assert(t, msg.flags == uint16(0))
 	assert(t, msg.seq == uint32(12345))
@@ -48,6 +56,8 @@ func TestParseNetlinkMessage(t *testing.T) {
 }
 
 func TestBytes(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
 	var data []byte
 
 	msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(data)), syscall.NLMSG_DONE, 0, uint32(12345), uint32(0), data}
@@ -64,6 +74,93 @@ func TestBytes(t *testing.T) {
 	assert(t, bs[9] == 48)
 }
 
+func TestUnmarshalInvalid(t *testing.T) {
+	bs := (&netlinkMsg{syscall.NLMSG_HDRLEN + 2, syscall.NLMSG_DONE, 0, 1, 0, []byte{1, 2}}).Bytes()
+
+	msg := &netlinkMsg{}
+	assert(t, msg.UnmarshalBinary(bs) == nil)
+	// header cut off
+	assert(t, errors.Is(msg.UnmarshalBinary(bs[:syscall.NLMSG_HDRLEN-1]), ErrShortMessage))
+	// data cut off
+	assert(t, errors.Is(msg.UnmarshalBinary(bs[:len(bs)-1]), ErrShortMessage))
+	// garbage after the message
+	_, err := parseNetlinkMsg(append(bs, 0, 0, 1))
+	assert(t, errors.Is(err, ErrTrailingData))
+	// length shorter than the header
+	NativeEndian.PutUint32(bs, syscall.NLMSG_HDRLEN-1)
+	assert(t, errors.Is(msg.UnmarshalBinary(bs), ErrInvalidLength))
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	f.Add((&netlinkMsg{syscall.NLMSG_HDRLEN + 3, syscall.NLMSG_DONE, 0, 1, 0, []byte{1, 2, 3}}).Bytes())
+	f.Add((&netlinkMsg{syscall.NLMSG_HDRLEN, syscall.NLMSG_ERROR, 0, 1, 0, nil}).Bytes())
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		msg := &netlinkMsg{}
+		if msg.UnmarshalBinary(bs) != nil {
+			return
+		}
+		out, err := msg.AppendBinary(nil)
+		if err != nil || !bytes.Equal(out, bs[:msg.len]) {
+			t.Errorf("round trip of %x gave %x, %v", bs, out, err)
+		}
+		parseNetlinkMsgs(bs)
+	})
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	msg := &netlinkMsg{syscall.NLMSG_HDRLEN + 64, syscall.NLMSG_DONE, 0, 1, 4711, make([]byte, 64)}
+	buf := make([]byte, 0, 128)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = msg.AppendBinary(buf[:0])
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	bs := (&netlinkMsg{syscall.NLMSG_HDRLEN + 64, syscall.NLMSG_DONE, 0, 1, 4711, make([]byte, 64)}).Bytes()
+	msg := &netlinkMsg{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg.UnmarshalBinary(bs)
+	}
+}
+
+// Socket must satisfy Transport
+var _ Transport = (*Socket)(nil)
+
+func TestPortIDs(t *testing.T) {
+	s1, err := Open(syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		t.Skipf("could not open netlink socket: %v", err)
+	}
+	defer s1.Close()
+	s2, err := Open(syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		t.Fatalf("could not open second netlink socket: %v", err)
+	}
+	defer s2.Close()
+
+	assert(t, s1.PortID() != 0)
+	assert(t, s2.PortID() != 0)
+	assert(t, s1.PortID() != s2.PortID())
+}
+
+func TestReceiveOtherPorts(t *testing.T) {
+	s1, s2 := pair(t)
+	defer s1.Close()
+	defer s2.Close()
+
+	// the header carries the sender's port, like kernel notifications do
+	// the port of the process which caused them
+	err := s1.Send([]byte{1, 2})
+	if err == syscall.EPERM {
+		t.Skipf("not allowed to send to user ports: %v", err)
+	}
+	assert(t, err == nil)
+	data, err := s2.Receive()
+	assert(t, err == nil && bytes.Equal(data, []byte{1, 2}))
+}
+
 func assert(t *testing.T, assertion bool) {
 	if !assertion {
 		t.Fatalf("assertion failed")
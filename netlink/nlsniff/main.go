@@ -0,0 +1,200 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package main provides a sniffer for netlink traffic
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/lambdasoup/go-netlink/netlink"
+
+	// register the Connector decoders
+	_ "github.com/lambdasoup/go-netlink/connector/dmulog"
+	_ "github.com/lambdasoup/go-netlink/connector/hyperv"
+	_ "github.com/lambdasoup/go-netlink/w1"
+)
+
+// parse arguments
+var iface = flag.String("i", "", "capture live from the given nlmon interface")
+var read = flag.String("r", "", "read a pcap capture, e.g. written by ibutton -capture")
+var write = flag.String("w", "", "write pcapng to the given file instead of printing")
+var family = flag.Int("family", -1, "only show the given netlink protocol family")
+
+// nlmon packet types, from linux/if_packet.h
+const (
+	packetUser   = 6
+	packetKernel = 7
+)
+
+// from linux/netlink.h
+var families = map[uint16]string{
+	syscall.NETLINK_ROUTE:          "route",
+	syscall.NETLINK_USERSOCK:       "usersock",
+	syscall.NETLINK_FIREWALL:       "firewall",
+	syscall.NETLINK_INET_DIAG:      "inet_diag",
+	syscall.NETLINK_NFLOG:          "nflog",
+	syscall.NETLINK_XFRM:           "xfrm",
+	syscall.NETLINK_SELINUX:        "selinux",
+	syscall.NETLINK_ISCSI:          "iscsi",
+	syscall.NETLINK_AUDIT:          "audit",
+	syscall.NETLINK_FIB_LOOKUP:     "fib_lookup",
+	syscall.NETLINK_CONNECTOR:      "connector",
+	syscall.NETLINK_NETFILTER:      "netfilter",
+	syscall.NETLINK_IP6_FW:         "ip6_fw",
+	syscall.NETLINK_DNRTMSG:        "dnrtmsg",
+	syscall.NETLINK_KOBJECT_UEVENT: "kobject_uevent",
+	syscall.NETLINK_GENERIC:        "generic",
+}
+
+// source yields captured packets until io.EOF
+type source func() (*netlink.Packet, error)
+
+func main() {
+
+	flag.Parse()
+
+	var src source
+	var err error
+	switch {
+	case *iface != "":
+		src, err = openNlmon(*iface)
+	case *read != "":
+		src, err = openPcap(*read)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Printf("could not open capture (%v)\n", err)
+		os.Exit(1)
+	}
+
+	sink := printPacket
+	if *write != "" {
+		f, err := os.Create(*write)
+		if err != nil {
+			fmt.Printf("could not create output (%v)\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w, err := netlink.NewPcapngWriter(f)
+		if err != nil {
+			fmt.Printf("could not write output (%v)\n", err)
+			os.Exit(1)
+		}
+		sink = w.WritePacket
+	}
+
+	for {
+		p, err := src()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			fmt.Printf("could not capture (%v)\n", err)
+			os.Exit(1)
+		}
+		if *family >= 0 && int(p.Protocol) != *family {
+			continue
+		}
+		err = sink(p)
+		if err != nil {
+			fmt.Printf("could not write packet (%v)\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func printPacket(p *netlink.Packet) error {
+	name, ok := families[p.Protocol]
+	if !ok {
+		name = fmt.Sprintf("family %d", p.Protocol)
+	}
+	_, err := fmt.Printf("%s %-3v %s\n%v\n\n", p.Time.Format("15:04:05.000000"), p.Direction, name,
+		netlink.Decode(int(p.Protocol), p.Data))
+	return err
+}
+
+// openPcap reads packets from a pcap file. The file may be a FIFO fed by a
+// tapped socket, in which case packets are shown as they arrive.
+func openPcap(path string) (source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := netlink.NewPcapReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return r.ReadPacket, nil
+}
+
+// openNlmon captures from an nlmon device, which mirrors all netlink
+// traffic of the host. It is set up with
+//
+//	ip link add nlmon0 type nlmon
+//	ip link set nlmon0 up
+func openNlmon(name string) (source, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	proto := htons(syscall.ETH_P_ALL)
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(proto))
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: proto, Ifindex: ifi.Index})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return func() (*netlink.Packet, error) {
+		buf := make([]byte, 65535)
+		n, from, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		p := &netlink.Packet{Time: time.Now(), Data: buf[:n]}
+		if sll, ok := from.(*syscall.SockaddrLinklayer); ok {
+			// nlmon stores the netlink protocol as link-layer protocol
+			p.Protocol = htons(sll.Protocol)
+			if sll.Pkttype == packetUser {
+				p.Direction = netlink.Outgoing
+			}
+		}
+		return p, nil
+	}, nil
+}
+
+// htons converts between host and network byte order
+func htons(v uint16) uint16 {
+	bs := make([]byte, 2)
+	binary.BigEndian.PutUint16(bs, v)
+	return netlink.NativeEndian.Uint16(bs)
+}
@@ -0,0 +1,214 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// pcap file format, from tcpdump.org
+const (
+	pcapMagic        = 0xa1b2c3d4
+	pcapMagicNano    = 0xa1b23c4d
+	pcapVersionMajor = 2
+	pcapVersionMinor = 4
+	pcapSnapLen      = 65535
+	pcapHdrLen       = 24
+	pcapRecHdrLen    = 16
+
+	linktypeNetlink = 253
+)
+
+// LINKTYPE_NETLINK pseudo header, same layout as LINKTYPE_LINUX_SLL
+const (
+	sllHdrLen     = 16
+	arphrdNetlink = 824
+	sllHost       = 0
+	sllOutgoing   = 4
+)
+
+// Direction of a captured datagram
+type Direction int
+
+// Datagram directions, seen from the capturing socket
+const (
+	Incoming Direction = iota
+	Outgoing
+)
+
+func (d Direction) String() string {
+	if d == Outgoing {
+		return "out"
+	}
+	return "in"
+}
+
+// Packet is a captured Netlink datagram
+type Packet struct {
+	Time      time.Time
+	Direction Direction
+	// Protocol is the Netlink protocol family, e.g. NETLINK_CONNECTOR
+	Protocol uint16
+	// Data holds the datagram including its Netlink headers
+	Data []byte
+}
+
+// PacketWriter is a destination for captured Packets
+type PacketWriter interface {
+	WritePacket(p *Packet) error
+}
+
+// putSLL writes the LINKTYPE_NETLINK pseudo header of p to b. The header is
+// in network byte order.
+func putSLL(b []byte, p *Packet) {
+	if p.Direction == Outgoing {
+		binary.BigEndian.PutUint16(b[0:], sllOutgoing)
+	} else {
+		binary.BigEndian.PutUint16(b[0:], sllHost)
+	}
+	binary.BigEndian.PutUint16(b[2:], arphrdNetlink)
+	// link-layer address length and address stay zero
+	binary.BigEndian.PutUint16(b[14:], p.Protocol)
+}
+
+// PcapWriter writes Packets in pcap format with the LINKTYPE_NETLINK link
+// type, as used by nlmon captures. The files can be opened by Wireshark.
+// It is safe for concurrent use.
+type PcapWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewPcapWriter writes the pcap file header to w and returns a PcapWriter
+// for the subsequent packets
+func NewPcapWriter(w io.Writer) (*PcapWriter, error) {
+	hdr := make([]byte, pcapHdrLen)
+	binary.LittleEndian.PutUint32(hdr[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(hdr[4:], pcapVersionMajor)
+	binary.LittleEndian.PutUint16(hdr[6:], pcapVersionMinor)
+	// thiszone and sigfigs stay zero
+	binary.LittleEndian.PutUint32(hdr[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(hdr[20:], linktypeNetlink)
+
+	_, err := w.Write(hdr)
+	if err != nil {
+		return nil, err
+	}
+	return &PcapWriter{w: w}, nil
+}
+
+// WritePacket appends the given Packet to the capture
+func (pw *PcapWriter) WritePacket(p *Packet) error {
+	n := sllHdrLen + len(p.Data)
+	rec := make([]byte, pcapRecHdrLen+n)
+
+	binary.LittleEndian.PutUint32(rec[0:], uint32(p.Time.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(p.Time.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(n))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(n))
+
+	putSLL(rec[pcapRecHdrLen:], p)
+	copy(rec[pcapRecHdrLen+sllHdrLen:], p.Data)
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	_, err := pw.w.Write(rec)
+	return err
+}
+
+// PcapReader reads Packets from a LINKTYPE_NETLINK pcap capture
+type PcapReader struct {
+	r     io.Reader
+	order binary.ByteOrder
+	nano  bool
+}
+
+// NewPcapReader reads the pcap file header from r and returns a PcapReader
+// for the subsequent packets
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	hdr := make([]byte, pcapHdrLen)
+	_, err := io.ReadFull(r, hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &PcapReader{r: r}
+	switch {
+	case binary.LittleEndian.Uint32(hdr) == pcapMagic:
+		pr.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr) == pcapMagic:
+		pr.order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr) == pcapMagicNano:
+		pr.order, pr.nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr) == pcapMagicNano:
+		pr.order, pr.nano = binary.BigEndian, true
+	default:
+		return nil, errors.New("not a pcap file")
+	}
+
+	linktype := pr.order.Uint32(hdr[20:])
+	if linktype != linktypeNetlink {
+		return nil, fmt.Errorf("unsupported pcap link type %d", linktype)
+	}
+
+	return pr, nil
+}
+
+// ReadPacket returns the next Packet of the capture, or io.EOF at its end
+func (pr *PcapReader) ReadPacket() (*Packet, error) {
+	hdr := make([]byte, pcapRecHdrLen)
+	_, err := io.ReadFull(pr.r, hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	sec := pr.order.Uint32(hdr[0:])
+	frac := pr.order.Uint32(hdr[4:])
+	n := pr.order.Uint32(hdr[8:])
+	if n < sllHdrLen || n > pcapSnapLen {
+		return nil, fmt.Errorf("invalid pcap record length %d", n)
+	}
+
+	rec := make([]byte, n)
+	_, err = io.ReadFull(pr.r, rec)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Packet{}
+	if pr.nano {
+		p.Time = time.Unix(int64(sec), int64(frac))
+	} else {
+		p.Time = time.Unix(int64(sec), int64(frac)*1000)
+	}
+	if binary.BigEndian.Uint16(rec[0:]) == sllOutgoing {
+		p.Direction = Outgoing
+	}
+	p.Protocol = binary.BigEndian.Uint16(rec[14:])
+	p.Data = rec[sllHdrLen:]
+
+	return p, nil
+}
@@ -0,0 +1,82 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPcapRoundTrip(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := NewPcapWriter(buf)
+	if err != nil {
+		t.Fatalf("could not write header: %v", err)
+	}
+
+	ts := time.Unix(1447600000, 123456000)
+	out := &Packet{ts, Outgoing, syscall.NETLINK_CONNECTOR, []byte{1, 2, 3}}
+	in := &Packet{ts.Add(time.Millisecond), Incoming, syscall.NETLINK_CONNECTOR, []byte{4, 5}}
+	assert(t, w.WritePacket(out) == nil)
+	assert(t, w.WritePacket(in) == nil)
+
+	// global header, two records with pseudo headers
+	assert(t, buf.Len() == 24+16+16+3+16+16+2)
+
+	r, err := NewPcapReader(buf)
+	if err != nil {
+		t.Fatalf("could not read header: %v", err)
+	}
+
+	p, err := r.ReadPacket()
+	assert(t, err == nil)
+	assert(t, p.Time.Equal(ts))
+	assert(t, p.Direction == Outgoing)
+	assert(t, p.Protocol == syscall.NETLINK_CONNECTOR)
+	assert(t, bytes.Equal(p.Data, out.Data))
+
+	p, err = r.ReadPacket()
+	assert(t, err == nil)
+	assert(t, p.Direction == Incoming)
+	assert(t, bytes.Equal(p.Data, in.Data))
+
+	_, err = r.ReadPacket()
+	assert(t, err == io.EOF)
+}
+
+func TestPcapngWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := NewPcapngWriter(buf)
+	if err != nil {
+		t.Fatalf("could not write header: %v", err)
+	}
+	assert(t, w.WritePacket(&Packet{time.Unix(1447600000, 0), Outgoing, syscall.NETLINK_CONNECTOR, []byte{1, 2, 3}}) == nil)
+
+	bs := buf.Bytes()
+	// section header, interface description, packet padded to 4 bytes
+	assert(t, len(bs) == 28+20+28+20+4)
+	assert(t, binary.LittleEndian.Uint32(bs[28+20+4:]) == 52)
+	assert(t, binary.LittleEndian.Uint32(bs[len(bs)-4:]) == 52)
+	assert(t, binary.LittleEndian.Uint16(bs[28+8:]) == linktypeNetlink)
+	assert(t, binary.LittleEndian.Uint32(bs[28+20+20:]) == 19)
+	assert(t, bytes.Equal(bs[28+20+28+16:28+20+28+19], []byte{1, 2, 3}))
+}
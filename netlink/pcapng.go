@@ -0,0 +1,96 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// pcapng block types, from the pcapng specification
+const (
+	pcapngSectionHeader    = 0x0A0D0D0A
+	pcapngInterfaceDesc    = 0x00000001
+	pcapngEnhancedPacket   = 0x00000006
+	pcapngByteOrderMagic   = 0x1A2B3C4D
+	pcapngEnhancedHdrLen   = 28
+	pcapngBlockTrailerLen  = 4
+	pcapngSectionHdrLen    = 28
+	pcapngInterfaceDescLen = 20
+)
+
+// PcapngWriter writes Packets in pcapng format with a single
+// LINKTYPE_NETLINK interface. It is safe for concurrent use.
+type PcapngWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewPcapngWriter writes the section header and interface description to
+// w and returns a PcapngWriter for the subsequent packets
+func NewPcapngWriter(w io.Writer) (*PcapngWriter, error) {
+	shb := make([]byte, pcapngSectionHdrLen)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngSectionHeader)
+	binary.LittleEndian.PutUint32(shb[4:], pcapngSectionHdrLen)
+	binary.LittleEndian.PutUint32(shb[8:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	binary.LittleEndian.PutUint16(shb[14:], 0)
+	// section length unknown
+	binary.LittleEndian.PutUint64(shb[16:], 0xffffffffffffffff)
+	binary.LittleEndian.PutUint32(shb[24:], pcapngSectionHdrLen)
+
+	idb := make([]byte, pcapngInterfaceDescLen)
+	binary.LittleEndian.PutUint32(idb[0:], pcapngInterfaceDesc)
+	binary.LittleEndian.PutUint32(idb[4:], pcapngInterfaceDescLen)
+	binary.LittleEndian.PutUint16(idb[8:], linktypeNetlink)
+	binary.LittleEndian.PutUint32(idb[12:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(idb[16:], pcapngInterfaceDescLen)
+
+	_, err := w.Write(append(shb, idb...))
+	if err != nil {
+		return nil, err
+	}
+	return &PcapngWriter{w: w}, nil
+}
+
+// WritePacket appends the given Packet as enhanced packet block. Timestamps
+// use the default resolution of microseconds.
+func (pw *PcapngWriter) WritePacket(p *Packet) error {
+	n := sllHdrLen + len(p.Data)
+	padded := (n + 3) &^ 3
+	l := pcapngEnhancedHdrLen + padded + pcapngBlockTrailerLen
+	epb := make([]byte, l)
+
+	ts := uint64(p.Time.UnixNano() / 1000)
+	binary.LittleEndian.PutUint32(epb[0:], pcapngEnhancedPacket)
+	binary.LittleEndian.PutUint32(epb[4:], uint32(l))
+	// interface 0
+	binary.LittleEndian.PutUint32(epb[12:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(epb[16:], uint32(ts))
+	binary.LittleEndian.PutUint32(epb[20:], uint32(n))
+	binary.LittleEndian.PutUint32(epb[24:], uint32(n))
+	putSLL(epb[pcapngEnhancedHdrLen:], p)
+	copy(epb[pcapngEnhancedHdrLen+sllHdrLen:], p.Data)
+	binary.LittleEndian.PutUint32(epb[l-pcapngBlockTrailerLen:], uint32(l))
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	_, err := pw.w.Write(epb)
+	return err
+}
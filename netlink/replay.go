@@ -0,0 +1,151 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/lambdasoup/go-netlink/log"
+)
+
+// Replayer is a Transport which plays back a capture written by a tapped
+// Socket in place of the kernel. Every Send must match the payload of the
+// next outgoing datagram of the capture. The incoming datagrams recorded
+// after it are then handed out by Receive, which returns io.EOF once the
+// capture has nothing more to deliver before the next Send.
+type Replayer struct {
+	// Rewrite, if set, adapts the capture to payloads which differ from
+	// the recorded ones, e.g. by their sequence numbers. It is called by
+	// Send with the payload sent and the one recorded, and returns the
+	// rewrite applied to the recorded payload and to the incoming payloads
+	// up to the next Send.
+	Rewrite func(sent, recorded []byte) func(recorded []byte) []byte
+
+	r       *PcapReader
+	next    *Packet
+	queue   [][]byte
+	rewrite func([]byte) []byte
+}
+
+// NewReplayer returns a Replayer for the pcap capture read from r
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	pr, err := NewPcapReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Replayer{r: pr}, nil
+}
+
+// peek returns the next packet of the capture without consuming it
+func (rp *Replayer) peek() (*Packet, error) {
+	if rp.next != nil {
+		return rp.next, nil
+	}
+	p, err := rp.r.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	rp.next = p
+	return p, nil
+}
+
+// queueIncoming moves all incoming packets up to the next outgoing one
+// to the receive queue
+func (rp *Replayer) queueIncoming() error {
+	for {
+		p, err := rp.peek()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if p.Direction == Outgoing {
+			return nil
+		}
+		rp.next = nil
+
+		msg, err := parseNetlinkMsg(p.Data)
+		if err != nil {
+			return err
+		}
+		data := msg.data
+		if rp.rewrite != nil {
+			data = rp.rewrite(data)
+		}
+		rp.queue = append(rp.queue, data)
+	}
+}
+
+// Send checks data against the next recorded outgoing payload
+func (rp *Replayer) Send(data []byte) error {
+	err := rp.queueIncoming()
+	if err != nil {
+		return err
+	}
+
+	p, err := rp.peek()
+	if err == io.EOF {
+		return fmt.Errorf("replay: send %x beyond end of capture", data)
+	}
+	if err != nil {
+		return err
+	}
+	rp.next = nil
+
+	msg, err := parseNetlinkMsg(p.Data)
+	if err != nil {
+		return err
+	}
+	recorded := msg.data
+	if rp.Rewrite != nil {
+		rp.rewrite = rp.Rewrite(data, recorded)
+		if rp.rewrite != nil {
+			recorded = rp.rewrite(recorded)
+		}
+	}
+	if !bytes.Equal(recorded, data) {
+		return fmt.Errorf("replay: sent %x, capture has %x", data, recorded)
+	}
+	log.Printf("\t\t\tNL REPLAY SEND: %v", msg)
+
+	return rp.queueIncoming()
+}
+
+// Receive returns the next recorded incoming payload
+func (rp *Replayer) Receive() ([]byte, error) {
+	if len(rp.queue) == 0 {
+		err := rp.queueIncoming()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(rp.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	data := rp.queue[0]
+	rp.queue = rp.queue[1:]
+	return data, nil
+}
+
+// Close is a no-op, the capture's reader is owned by the caller
+func (rp *Replayer) Close() {
+}
@@ -0,0 +1,105 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"bytes"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, _ := NewPcapWriter(buf)
+
+	record := func(dir Direction, data string) {
+		msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(data)), syscall.NLMSG_DONE, 0, 1, 0, []byte(data)}
+		w.WritePacket(&Packet{time.Now(), dir, syscall.NETLINK_CONNECTOR, msg.Bytes()})
+	}
+	record(Outgoing, "request 1")
+	record(Incoming, "reply 1a")
+	record(Incoming, "reply 1b")
+	record(Outgoing, "request 2")
+	record(Incoming, "reply 2")
+
+	r, err := NewReplayer(buf)
+	if err != nil {
+		t.Fatalf("could not open replay: %v", err)
+	}
+
+	assert(t, r.Send([]byte("request 1")) == nil)
+	data, err := r.Receive()
+	assert(t, err == nil && string(data) == "reply 1a")
+	data, err = r.Receive()
+	assert(t, err == nil && string(data) == "reply 1b")
+	_, err = r.Receive()
+	assert(t, err == io.EOF)
+
+	assert(t, r.Send([]byte("request 3")) != nil)
+}
+
+func TestReplayRewrite(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, _ := NewPcapWriter(buf)
+
+	record := func(dir Direction, data string) {
+		msg := &netlinkMsg{uint32(syscall.NLMSG_HDRLEN + len(data)), syscall.NLMSG_DONE, 0, 1, 0, []byte(data)}
+		w.WritePacket(&Packet{time.Now(), dir, syscall.NETLINK_CONNECTOR, msg.Bytes()})
+	}
+	record(Outgoing, "request 1")
+	record(Incoming, "reply 1")
+
+	r, err := NewReplayer(buf)
+	if err != nil {
+		t.Fatalf("could not open replay: %v", err)
+	}
+	// the live session numbers its requests differently
+	r.Rewrite = func(sent, recorded []byte) func([]byte) []byte {
+		n := sent[len(sent)-1]
+		return func(bs []byte) []byte {
+			return append(bs[:len(bs)-1:len(bs)-1], n)
+		}
+	}
+
+	assert(t, r.Send([]byte("request 7")) == nil)
+	data, err := r.Receive()
+	assert(t, err == nil && string(data) == "reply 7")
+}
+
+func TestTap(t *testing.T) {
+	s, err := Open(syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		t.Skipf("could not open netlink socket: %v", err)
+	}
+	defer s.Close()
+
+	buf := new(bytes.Buffer)
+	w, _ := NewPcapWriter(buf)
+	s.Tap(w)
+
+	// an empty connector message nobody listens to
+	assert(t, s.Send(make([]byte, 20)) == nil)
+
+	r, _ := NewPcapReader(buf)
+	p, err := r.ReadPacket()
+	assert(t, err == nil)
+	assert(t, p.Direction == Outgoing)
+	assert(t, len(p.Data) == syscall.NLMSG_HDRLEN+20)
+}
@@ -0,0 +1,187 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package netlink
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// rtnetlink message families, from linux/rtnetlink.h. Every family has a
+// NEW, DEL, GET and SET message type, in that order.
+var rtmFamilies = []struct {
+	name   string
+	hdrLen int
+	attrs  map[uint16]string
+}{
+	{"LINK", syscall.SizeofIfInfomsg, linkAttrs},
+	{"ADDR", syscall.SizeofIfAddrmsg, addrAttrs},
+	{"ROUTE", syscall.SizeofRtMsg, routeAttrs},
+	{"NEIGH", 12, nil},
+	{"RULE", 12, nil},
+	{"QDISC", 20, nil},
+	{"TCLASS", 20, nil},
+	{"TFILTER", 20, nil},
+}
+
+var rtmOps = []string{"NEW", "DEL", "GET", "SET"}
+
+// from linux/netlink.h
+const nlaTypeMask = 0x3fff
+
+// from linux/if_link.h
+var linkAttrs = map[uint16]string{
+	syscall.IFLA_ADDRESS:   "IFLA_ADDRESS",
+	syscall.IFLA_BROADCAST: "IFLA_BROADCAST",
+	syscall.IFLA_IFNAME:    "IFLA_IFNAME",
+	syscall.IFLA_MTU:       "IFLA_MTU",
+	syscall.IFLA_LINK:      "IFLA_LINK",
+	syscall.IFLA_QDISC:     "IFLA_QDISC",
+	syscall.IFLA_STATS:     "IFLA_STATS",
+	syscall.IFLA_MASTER:    "IFLA_MASTER",
+	syscall.IFLA_OPERSTATE: "IFLA_OPERSTATE",
+	syscall.IFLA_LINKMODE:  "IFLA_LINKMODE",
+	syscall.IFLA_LINKINFO:  "IFLA_LINKINFO",
+	syscall.IFLA_TXQLEN:    "IFLA_TXQLEN",
+}
+
+// from linux/if_addr.h
+var addrAttrs = map[uint16]string{
+	syscall.IFA_ADDRESS:   "IFA_ADDRESS",
+	syscall.IFA_LOCAL:     "IFA_LOCAL",
+	syscall.IFA_LABEL:     "IFA_LABEL",
+	syscall.IFA_BROADCAST: "IFA_BROADCAST",
+	syscall.IFA_ANYCAST:   "IFA_ANYCAST",
+	syscall.IFA_CACHEINFO: "IFA_CACHEINFO",
+}
+
+// from linux/rtnetlink.h
+var routeAttrs = map[uint16]string{
+	syscall.RTA_DST:       "RTA_DST",
+	syscall.RTA_SRC:       "RTA_SRC",
+	syscall.RTA_IIF:       "RTA_IIF",
+	syscall.RTA_OIF:       "RTA_OIF",
+	syscall.RTA_GATEWAY:   "RTA_GATEWAY",
+	syscall.RTA_PRIORITY:  "RTA_PRIORITY",
+	syscall.RTA_PREFSRC:   "RTA_PREFSRC",
+	syscall.RTA_METRICS:   "RTA_METRICS",
+	syscall.RTA_MULTIPATH: "RTA_MULTIPATH",
+	syscall.RTA_FLOW:      "RTA_FLOW",
+	syscall.RTA_CACHEINFO: "RTA_CACHEINFO",
+	syscall.RTA_TABLE:     "RTA_TABLE",
+}
+
+// attributes rendered as text instead of hex
+var (
+	stringAttrs = map[string]bool{"IFLA_IFNAME": true, "IFLA_QDISC": true, "IFA_LABEL": true}
+	ipAttrs     = map[string]bool{
+		"IFA_ADDRESS": true, "IFA_LOCAL": true, "IFA_BROADCAST": true, "IFA_ANYCAST": true,
+		"RTA_DST": true, "RTA_SRC": true, "RTA_GATEWAY": true, "RTA_PREFSRC": true,
+	}
+)
+
+func init() {
+	RegisterDecoder(syscall.NETLINK_ROUTE, decodeRoute)
+}
+
+// rtmName returns the RTM_* name of an rtnetlink message type
+func rtmName(msgType uint16) string {
+	if msgType < syscall.RTM_BASE {
+		return ""
+	}
+	i := int(msgType-syscall.RTM_BASE) / 4
+	if i >= len(rtmFamilies) {
+		return ""
+	}
+	return "RTM_" + rtmOps[(msgType-syscall.RTM_BASE)%4] + rtmFamilies[i].name
+}
+
+// decodeRoute decodes rtnetlink payloads into their family header and
+// attributes
+func decodeRoute(n *Node, msgType uint16, payload []byte) {
+	i := int(msgType-syscall.RTM_BASE) / 4
+	if msgType < syscall.RTM_BASE || i >= len(rtmFamilies) {
+		n.AddHex("payload", payload)
+		return
+	}
+	family := rtmFamilies[i]
+
+	if len(payload) < family.hdrLen {
+		n.AddHex("truncated", payload)
+		return
+	}
+	n.AddHex("header", payload[:family.hdrLen])
+
+	// a dump request may carry a bare family header
+	if rtaAlign(family.hdrLen) >= len(payload) {
+		return
+	}
+	decodeAttrs(n, family.attrs, payload[rtaAlign(family.hdrLen):])
+}
+
+func rtaAlign(l int) int {
+	return (l + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+}
+
+// decodeAttrs decodes a list of rtnetlink attributes
+func decodeAttrs(n *Node, names map[uint16]string, data []byte) {
+	for len(data) > 0 {
+		if len(data) < syscall.SizeofRtAttr {
+			n.AddHex("truncated", data)
+			return
+		}
+		l := int(NativeEndian.Uint16(data[0:]))
+		// strip the nested and byte order flags
+		t := NativeEndian.Uint16(data[2:]) & nlaTypeMask
+		if l < syscall.SizeofRtAttr || l > len(data) {
+			n.AddHex("invalid attribute", data)
+			return
+		}
+		value := data[syscall.SizeofRtAttr:l]
+
+		name, ok := names[t]
+		if !ok {
+			name = fmt.Sprintf("attr %d", t)
+		}
+		switch {
+		case stringAttrs[name]:
+			n.Add(name, "%q", trimNul(value))
+		case ipAttrs[name] && (len(value) == net.IPv4len || len(value) == net.IPv6len):
+			n.Add(name, "%v", net.IP(value))
+		case len(value) == 4:
+			n.Add(name, "%d", NativeEndian.Uint32(value))
+		default:
+			n.AddHex(name, value)
+		}
+
+		if rtaAlign(l) >= len(data) {
+			return
+		}
+		data = data[rtaAlign(l):]
+	}
+}
+
+func trimNul(bs []byte) string {
+	for i, b := range bs {
+		if b == 0 {
+			return string(bs[:i])
+		}
+	}
+	return string(bs)
+}
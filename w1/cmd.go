@@ -18,9 +18,10 @@
 package w1
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
+	"math"
+
+	"github.com/lambdasoup/go-netlink/netlink"
 )
 
 type cmdType uint8
@@ -38,6 +39,25 @@ const (
 	cmdListSlaves
 )
 
+var cmdTypeNames = []string{
+	"W1_CMD_READ",
+	"W1_CMD_WRITE",
+	"W1_CMD_SEARCH",
+	"W1_CMD_ALARM_SEARCH",
+	"W1_CMD_TOUCH",
+	"W1_CMD_RESET",
+	"W1_CMD_SLAVE_ADD",
+	"W1_CMD_SLAVE_REMOVE",
+	"W1_CMD_LIST_SLAVES",
+}
+
+func (t cmdType) String() string {
+	if int(t) < len(cmdTypeNames) {
+		return cmdTypeNames[t]
+	}
+	return fmt.Sprintf("W1_CMD_%d", uint8(t))
+}
+
 // Cmd is a 1-Wire command
 // From drivers/w1/w1_netlink.h
 type cmd struct {
@@ -50,13 +70,21 @@ func (c *cmd) String() string {
 	return fmt.Sprintf("W1Cmd{%v, data %x}", c.cmd, c.data)
 }
 
-func (c *cmd) toBytes() []byte {
-	buf := new(bytes.Buffer)
-
-	binary.Write(buf, binary.LittleEndian, c.cmd)
-	binary.Write(buf, binary.LittleEndian, c.res)
-	binary.Write(buf, binary.LittleEndian, uint16(len(c.data)))
-	buf.Write(c.data)
+// AppendBinary appends the wire format of c to b. The length is taken
+// from the data.
+func (c *cmd) AppendBinary(b []byte) ([]byte, error) {
+	if len(c.data) > math.MaxUint16 {
+		return b, fmt.Errorf("w1: command data of %d bytes exceeds the maximum of %d", len(c.data), math.MaxUint16)
+	}
+	n := len(b)
+	b = append(b, make([]byte, cmdHdrLen)...)
+	b[n] = byte(c.cmd)
+	b[n+1] = c.res
+	netlink.NativeEndian.PutUint16(b[n+2:], uint16(len(c.data)))
+	return append(b, c.data...), nil
+}
 
-	return buf.Bytes()
+// MarshalBinary returns the wire format of c
+func (c *cmd) MarshalBinary() ([]byte, error) {
+	return c.AppendBinary(make([]byte, 0, cmdHdrLen+len(c.data)))
 }
@@ -0,0 +1,121 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"syscall"
+
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// Header lengths, from drivers/w1/w1_netlink.h
+const (
+	msgHdrLen = 12
+	cmdHdrLen = 4
+)
+
+func init() {
+	connector.RegisterDecoder(connector.W1, decode)
+}
+
+// decode renders the 1-Wire messages of a Connector payload
+func decode(n *netlink.Node, data []byte) {
+	for len(data) > 0 {
+		if len(data) < msgHdrLen {
+			n.AddHex("truncated", data)
+			return
+		}
+
+		t := msgType(data[0])
+		status := data[1]
+		l := int(netlink.NativeEndian.Uint16(data[2:]))
+
+		m := n.Add("w1", "%v", t)
+		if status == 0 {
+			m.Add("status", "0")
+		} else {
+			m.Add("status", "%d (%v)", status, syscall.Errno(status))
+		}
+		m.Add("len", "%d", l)
+		switch t {
+		case slaveAdd, slaveRemove, slaveCmd:
+			rom := romBytes(data[4:12])
+			m.Add("slave", "%v crc %02x", rom, rom.CRC())
+		case masterAdd, masterRemove, masterCmd:
+			m.Add("master", "%d", netlink.NativeEndian.Uint32(data[4:]))
+		}
+
+		if msgHdrLen+l > len(data) {
+			m.AddHex("invalid length", data[msgHdrLen:])
+			return
+		}
+		body := data[msgHdrLen : msgHdrLen+l]
+
+		switch t {
+		case masterCmd, slaveCmd:
+			decodeCmds(m, body)
+		case listMasters:
+			for i := 0; i+4 <= len(body); i += 4 {
+				m.Add("master", "%d", netlink.NativeEndian.Uint32(body[i:]))
+			}
+		default:
+			if len(body) > 0 {
+				m.AddHex("data", body)
+			}
+		}
+
+		data = data[msgHdrLen+l:]
+	}
+}
+
+// decodeCmds renders a sequence of 1-Wire commands
+func decodeCmds(n *netlink.Node, data []byte) {
+	for len(data) > 0 {
+		if len(data) < cmdHdrLen {
+			n.AddHex("truncated", data)
+			return
+		}
+
+		t := cmdType(data[0])
+		l := int(netlink.NativeEndian.Uint16(data[2:]))
+
+		c := n.Add("cmd", "%v", t)
+		c.Add("len", "%d", l)
+
+		if cmdHdrLen+l > len(data) {
+			c.AddHex("invalid length", data[cmdHdrLen:])
+			return
+		}
+		body := data[cmdHdrLen : cmdHdrLen+l]
+
+		switch t {
+		case cmdListSlaves, cmdSearch, cmdAlarmSearch:
+			for i := 0; i+8 <= len(body); i += 8 {
+				rom := romBytes(body[i : i+8])
+				c.Add("slave", "%v crc %02x", rom, rom.CRC())
+			}
+		default:
+			if len(body) > 0 {
+				c.AddHex("data", body)
+			}
+		}
+
+		data = data[cmdHdrLen+l:]
+	}
+}
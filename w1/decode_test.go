@@ -0,0 +1,61 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"encoding/binary"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+func TestDecode(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	c := cmd{cmdRead, 0, []byte{0xde, 0xad}}
+	slave := &Slave{0x41, [6]byte{1, 2, 3, 4, 5, 6}, 0x17, nil}
+	m := &msg{slaveCmd, 0, uint16(len(marshal(&c))), nil, slave, 0, marshal(&c)}
+	cn := cnReply(make([]byte, 20), false, marshal(m))
+	copy(cn, []byte{3, 0, 0, 0, 1, 0, 0, 0})
+
+	// wrap into a netlink header
+	datagram := []byte{byte(16 + len(cn)), 0, 0, 0, 3, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}
+	datagram = append(datagram, cn...)
+
+	s := netlink.Decode(syscall.NETLINK_CONNECTOR, datagram).String()
+	t.Log(s)
+
+	assert(t, strings.Contains(s, "netlink: NLMSG_DONE"))
+	assert(t, strings.Contains(s, "connector: w1 (3:1)"))
+	assert(t, strings.Contains(s, "w1: W1_SLAVE_CMD"))
+	assert(t, strings.Contains(s, "slave: 41-060504030201 crc 17"))
+	assert(t, strings.Contains(s, "cmd: W1_CMD_READ"))
+	assert(t, strings.Contains(s, "de ad"))
+}
+
+func FuzzDecode(f *testing.F) {
+	c := cmd{cmdListSlaves, 0, make([]byte, 8)}
+	f.Add(marshal(&msg{masterCmd, 0, 0, &Master{id: 1}, nil, 0, marshal(&c)}))
+	f.Add(marshal(&msg{listMasters, 0, 0, nil, nil, 0, []byte{1, 0, 0, 0}}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decode(&netlink.Node{}, data)
+	})
+}
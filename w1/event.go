@@ -0,0 +1,129 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"fmt"
+
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/log"
+)
+
+// EventType is the kind of a hotplug Event
+type EventType int
+
+// Event types, in the order of the kernel's message types
+const (
+	SlaveAdded EventType = iota
+	SlaveRemoved
+	MasterAdded
+	MasterRemoved
+)
+
+var eventTypeNames = []string{
+	"slave added",
+	"slave removed",
+	"master added",
+	"master removed",
+}
+
+func (t EventType) String() string {
+	if t >= 0 && int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event is a hotplug notification of the kernel
+type Event struct {
+	Type EventType
+	// Master is the ID of an added or removed master
+	Master uint32
+	// ROM is the ID of an added or removed slave
+	ROM ROM
+}
+
+func (e Event) String() string {
+	if e.Type == MasterAdded || e.Type == MasterRemoved {
+		return fmt.Sprintf("W1Event{%v, master %d}", e.Type, e.Master)
+	}
+	return fmt.Sprintf("W1Event{%v, slave %v}", e.Type, e.ROM)
+}
+
+// Events subscribes to the hotplug broadcasts of the kernel and returns
+// the channel of their events. The broadcasts are received on a socket of
+// their own, so requests may be issued meanwhile. The channel is closed by
+// Close, or once receiving fails.
+func (w1 *W1) Events() (<-chan Event, error) {
+	listen := w1.listen
+	if listen == nil {
+		listen = func() (*connector.Listener, error) {
+			return connector.Listen(connector.W1)
+		}
+	}
+	l, err := listen()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	done := make(chan struct{})
+	w1.stops = append(w1.stops, func() {
+		l.Close()
+		close(done)
+	})
+
+	go func() {
+		defer close(events)
+		for m := range l.Messages() {
+			for _, e := range parseEvents(m.Data) {
+				log.Printf("W1 EVENT: %v", e)
+				select {
+				case events <- e:
+				case <-done:
+					return
+				}
+			}
+		}
+		if err := l.Err(); err != nil {
+			log.Printf("W1 EVENTS STOPPED: %v", err)
+		}
+	}()
+	return events, nil
+}
+
+// parseEvents returns the hotplug events among the w1 messages of a
+// broadcast. Other messages and malformed data are skipped.
+func parseEvents(data []byte) (events []Event) {
+	for len(data) >= msgHdrLen {
+		m, err := parseW1Msg(data)
+		if err != nil {
+			log.Printf("W1 EVENT SKIP: %v", err)
+			return
+		}
+		data = data[msgHdrLen+len(m.data):]
+
+		switch m.w1Type {
+		case slaveAdd, slaveRemove:
+			events = append(events, Event{Type: EventType(m.w1Type), ROM: m.slave.ROM()})
+		case masterAdd, masterRemove:
+			events = append(events, Event{Type: EventType(m.w1Type), Master: m.master.id})
+		}
+	}
+	return
+}
@@ -0,0 +1,120 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lambdasoup/go-netlink/connector"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// broadcasts is a netlink.Transport delivering queued kernel broadcasts.
+// Once drained it ends with io.EOF, or times out like a Socket with a
+// receive timeout if wait is set.
+type broadcasts struct {
+	queue [][]byte
+	wait  bool
+}
+
+func (b *broadcasts) JoinGroup(group uint32) error { return nil }
+
+func (b *broadcasts) Send(data []byte) error { return syscall.EOPNOTSUPP }
+
+func (b *broadcasts) Receive() ([]byte, error) {
+	if len(b.queue) > 0 {
+		data := b.queue[0]
+		b.queue = b.queue[1:]
+		return data, nil
+	}
+	if b.wait {
+		time.Sleep(time.Millisecond)
+		return nil, syscall.EAGAIN
+	}
+	return nil, io.EOF
+}
+
+func (b *broadcasts) Close() {}
+
+// listenOn makes w1 receive its events from b
+func listenOn(w1 *W1, b *broadcasts) {
+	w1.listen = func() (*connector.Listener, error) {
+		return connector.NewListener(connector.New(b, connector.W1))
+	}
+}
+
+// broadcast wraps a w1 message in a kernel connector broadcast
+func broadcast(seq uint32, w1 []byte) []byte {
+	bs := make([]byte, 20)
+	netlink.NativeEndian.PutUint32(bs[0:], connector.W1.Idx())
+	netlink.NativeEndian.PutUint32(bs[4:], connector.W1.Val())
+	netlink.NativeEndian.PutUint32(bs[8:], seq)
+	netlink.NativeEndian.PutUint16(bs[16:], uint16(len(w1)))
+	return append(bs, w1...)
+}
+
+func TestEvents(t *testing.T) {
+	rom := ROM{0x41, 0x34, 0xab, 0x12, 0, 0, 0, 0xb7}
+	s := &Slave{family: 0x41, uid: [6]byte{0x34, 0xab, 0x12}, crc: 0xb7}
+	b := &broadcasts{queue: [][]byte{
+		broadcast(1, marshal(&msg{masterAdd, 0, 0, &Master{id: 2}, nil, 0, nil})),
+		broadcast(2, marshal(&msg{slaveAdd, 0, 0, nil, s, 0, nil})),
+		// replies and garbage are no events
+		broadcast(3, marshal(&msg{listMasters, 0, 0, nil, nil, 0, []byte{2, 0, 0, 0}})),
+		broadcast(4, []byte{1, 2, 3}),
+		broadcast(5, marshal(&msg{slaveRemove, 0, 0, nil, s, 0, nil})),
+	}}
+
+	w1 := New(&fakeKernel{})
+	listenOn(w1, b)
+	events, err := w1.Events()
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	var got []Event
+	for e := range events {
+		got = append(got, e)
+	}
+
+	assert(t, len(got) == 3)
+	assert(t, got[0].Type == MasterAdded && got[0].Master == 2)
+	assert(t, got[1].Type == SlaveAdded && got[1].ROM == rom)
+	assert(t, got[2].Type == SlaveRemoved && got[2].ROM == rom)
+	assert(t, got[1].String() == "W1Event{slave added, slave 41-00000012ab34}")
+}
+
+func TestEventsClose(t *testing.T) {
+	w1 := New(&fakeKernel{})
+	listenOn(w1, &broadcasts{wait: true})
+	events, err := w1.Events()
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+
+	w1.Close()
+	select {
+	case _, ok := <-events:
+		assert(t, !ok)
+	case <-time.After(time.Second):
+		t.Fatalf("events not closed")
+	}
+}
@@ -0,0 +1,110 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is wrapped by the errors of lookups that found nothing
+var ErrNotFound = errors.New("w1: not found")
+
+// MasterNotFoundError is returned when there is no master of the given ID
+type MasterNotFoundError struct {
+	ID uint32
+}
+
+func (e *MasterNotFoundError) Error() string {
+	return fmt.Sprintf("w1: master %d not found", e.ID)
+}
+
+// Unwrap returns ErrNotFound
+func (e *MasterNotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+// SlaveNotFoundError is returned when there is no slave of the given ROM
+// ID. Master is zero for bus wide lookups.
+type SlaveNotFoundError struct {
+	ROM    ROM
+	Master uint32
+}
+
+func (e *SlaveNotFoundError) Error() string {
+	if e.Master == 0 {
+		return fmt.Sprintf("w1: slave %v not found", e.ROM)
+	}
+	return fmt.Sprintf("w1: slave %v not found on master %d", e.ROM, e.Master)
+}
+
+// Unwrap returns ErrNotFound
+func (e *SlaveNotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+// ID returns the kernel's ID of this Master, as in w1_bus_master<ID>
+func (ms *Master) ID() uint32 {
+	return ms.id
+}
+
+// Master returns the master of the given ID
+func (w1 *W1) Master(id uint32) (*Master, error) {
+	ms, err := w1.ListMasters()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ms {
+		if ms[i].id == id {
+			return &ms[i], nil
+		}
+	}
+	return nil, &MasterNotFoundError{id}
+}
+
+// Slave returns the slave of the given ROM ID among the slaves the kernel
+// registered on this Master
+func (ms *Master) Slave(rom ROM) (*Slave, error) {
+	ss, err := ms.ListSlaves()
+	// corrupted ROM IDs of other slaves do not matter
+	if err != nil && !errors.Is(err, ErrCRC) {
+		return nil, err
+	}
+	for i := range ss {
+		if ss[i].ROM() == rom {
+			return &ss[i], nil
+		}
+	}
+	return nil, &SlaveNotFoundError{rom, ms.id}
+}
+
+// FindSlave returns the slave of the given ROM ID on any master
+func (w1 *W1) FindSlave(rom ROM) (*Slave, error) {
+	ms, err := w1.ListMasters()
+	if err != nil {
+		return nil, err
+	}
+	for i := range ms {
+		s, err := ms[i].Slave(rom)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		return s, err
+	}
+	return nil, &SlaveNotFoundError{ROM: rom}
+}
@@ -0,0 +1,88 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+)
+
+// bus answers list masters and list slaves requests for the given masters
+// and their slaves
+func bus(t *testing.T, slaves map[uint32][]ROM) *fakeKernel {
+	return &fakeKernel{handle: func(req []byte) [][]byte {
+		m, err := parseW1Msg(req[20:])
+		assert(t, err == nil)
+
+		switch m.w1Type {
+		case listMasters:
+			var ids []byte
+			for id := uint32(1); id <= uint32(len(slaves)); id++ {
+				ids = binary.LittleEndian.AppendUint32(ids, id)
+			}
+			reply := &msg{listMasters, 0, 0, nil, nil, 0, ids}
+			return [][]byte{cnReply(req, false, marshal(reply))}
+		case masterCmd:
+			data := []byte{byte(cmdListSlaves), 0, 0, 0}
+			for _, rom := range slaves[m.master.id] {
+				data = append(data, rom[:]...)
+			}
+			reply := &msg{masterCmd, 0, 0, m.master, nil, 0, data}
+			status := &msg{masterCmd, 0, 0, m.master, nil, 0, []byte{byte(cmdListSlaves), 0, 0, 0}}
+			return [][]byte{
+				cnReply(req, false, marshal(reply)),
+				cnReply(req, true, marshal(status)),
+			}
+		}
+		return nil
+	}}
+}
+
+func TestFind(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	logger, _ := ParseROM("41-00000012ab34")
+	sensor, _ := ParseROM("28-060504030201")
+	missing, _ := ParseROM("41-000000000001")
+	w1 := New(bus(t, map[uint32][]ROM{
+		1: {sensor},
+		2: {sensor, logger},
+		3: nil,
+	}))
+
+	ms, err := w1.Master(2)
+	assert(t, err == nil && ms.ID() == 2)
+	_, err = w1.Master(4)
+	var mErr *MasterNotFoundError
+	assert(t, errors.Is(err, ErrNotFound) && errors.As(err, &mErr) && mErr.ID == 4)
+
+	s, err := ms.Slave(logger)
+	assert(t, err == nil && s.ROM() == logger)
+	_, err = ms.Slave(missing)
+	var sErr *SlaveNotFoundError
+	assert(t, errors.As(err, &sErr) && sErr.Master == 2 && sErr.ROM == missing)
+
+	s, err = w1.FindSlave(logger)
+	assert(t, err == nil && s.ROM() == logger && s.master.ID() == 2)
+	_, err = w1.FindSlave(missing)
+	assert(t, errors.Is(err, ErrNotFound))
+	assert(t, err.Error() == "w1: slave 41-000000000001 not found")
+}
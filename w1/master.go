@@ -19,9 +19,11 @@ package w1
 
 import (
 	"bytes"
-	"encoding/binary"
+	"errors"
+	"fmt"
 
 	"github.com/lambdasoup/go-netlink/log"
+	"github.com/lambdasoup/go-netlink/netlink"
 )
 
 // Master is a 1-Wire Master device
@@ -35,63 +37,100 @@ func (ms *Master) Close() {
 	ms.w1.Close()
 }
 
-// ListSlaves returns a list of this master's slaves
+// ListSlaves returns a list of this master's slaves. Slaves whose ROM ID
+// was corrupted on the way are left out. They are reported by an error
+// wrapping ErrCRC, returned along with the valid slaves.
 func (ms *Master) ListSlaves() (slaves []Slave, err error) {
 	log.Print("W1 LIST SLAVES")
 
 	// send list slaves request
 	c := cmd{cmdListSlaves, 0, nil}
-	req := &msg{masterCmd, 0, uint16(len(c.toBytes())), ms, nil, 0, c.toBytes()}
+	body, err := c.MarshalBinary()
+	if err != nil {
+		return
+	}
+	req := &msg{masterCmd, 0, uint16(len(body)), ms, nil, 0, body}
 
 	msgs, err := ms.w1.request(req, 1)
 	if err != nil {
 		return
 	}
 	// expecting only one response message
-	msg := msgs[0]
-	buf := bytes.NewBuffer(msg.data)
+	return ms.parseSlaves(msgs[:1])
+}
+
+// Search runs a search on the bus and returns the slaves found, including
+// those the kernel has not registered yet. Like ListSlaves it reports
+// corrupted ROM IDs by an error wrapping ErrCRC.
+func (ms *Master) Search() ([]Slave, error) {
+	log.Print("W1 SEARCH")
+	return ms.search(cmdSearch)
+}
+
+// AlarmSearch runs a search on the bus for the slaves in alarm state
+func (ms *Master) AlarmSearch() ([]Slave, error) {
+	log.Print("W1 ALARM SEARCH")
+	return ms.search(cmdAlarmSearch)
+}
 
-	// skip W1_CMD part
-	buf.Next(4)
-	for i := 0; i < int(msg.len-4); i = i + 8 {
-		slave := new(Slave)
-		binary.Read(buf, binary.LittleEndian, &slave.family)
-		binary.Read(buf, binary.LittleEndian, &slave.uid)
-		binary.Read(buf, binary.LittleEndian, &slave.crc)
-		slave.master = ms
-		slaves = append(slaves, *slave)
+func (ms *Master) search(t cmdType) (slaves []Slave, err error) {
+	c := cmd{t, 0, nil}
+	body, err := c.MarshalBinary()
+	if err != nil {
+		return
+	}
+	req := &msg{masterCmd, 0, uint16(len(body)), ms, nil, 0, body}
+
+	// the kernel replies once per bunch of slaves found, or not at all,
+	// and sends the status last
+	msgs, err := ms.w1.exchange([]*msg{req}, 1, 0)
+	if err != nil {
+		return
 	}
+	return ms.parseSlaves(msgs)
+}
 
+// parseSlaves reads the ROM IDs of slave listing replies
+func (ms *Master) parseSlaves(msgs []msg) (slaves []Slave, err error) {
+	var corrupted []ROM
+	for _, m := range msgs {
+		if len(m.data) < cmdHdrLen {
+			return nil, &netlink.ParseError{Layer: "w1", Err: netlink.ErrShortMessage, Want: cmdHdrLen, Have: len(m.data)}
+		}
+		// skip W1_CMD part
+		for i := cmdHdrLen; i+8 <= len(m.data); i = i + 8 {
+			slave := parseSlave(m.data[i : i+8])
+			if rom := slave.ROM(); !rom.Valid() {
+				corrupted = append(corrupted, rom)
+				continue
+			}
+			slave.master = ms
+			slaves = append(slaves, *slave)
+		}
+	}
+	if len(corrupted) > 0 {
+		err = fmt.Errorf("w1: slaves %v of master %d: %w", corrupted, ms.id, ErrCRC)
+	}
 	return
 }
 
 func (ms *Master) readSlave(slave *Slave, args []byte, pages int) (data []byte, err error) {
 	log.Print("W1 READ SLAVE")
 
-	body := bytes.NewBuffer(make([]byte, 0))
-
-	// one write command
-	c := cmd{cmdWrite, 0, args}
-	body.Write(c.toBytes())
-
-	// one read command per page
+	// one write command, then one read command per page
 	// page is 32 data + 2 crc = 34 bytes
+	tx := slave.Tx().Write(args)
 	for i := 0; i < pages; i++ {
-		c := cmd{cmdRead, 0, make([]byte, 34)}
-		body.Write(c.toBytes())
+		tx.Read(34)
 	}
-
-	req := &msg{slaveCmd, 0, uint16(body.Len()), nil, slave, 0, body.Bytes()}
-
-	msgs, err := ms.w1.request(req, pages+1)
+	results, err := tx.Run()
 	if err != nil {
 		return
 	}
 
-	buf := bytes.NewBuffer(make([]byte, 0))
-	for _, m := range msgs {
-		// throw away w1 cmd header
-		buf.Write(m.data[4:])
+	buf := bytes.NewBuffer(make([]byte, 0, pages*34))
+	for _, r := range results[1:] {
+		buf.Write(r)
 	}
 	data = buf.Bytes()
 
@@ -101,9 +140,113 @@ func (ms *Master) readSlave(slave *Slave, args []byte, pages int) (data []byte,
 func (ms *Master) writeSlave(slave *Slave, args []byte) (err error) {
 	log.Print("W1 WRITE SLAVE")
 
-	cmd := cmd{cmdWrite, 0, args}
-	req := &msg{slaveCmd, 0, uint16(len(cmd.toBytes())), nil, slave, 0, cmd.toBytes()}
-
-	err = ms.w1.send(req)
+	_, err = slave.Tx().Write(args).Run()
 	return
 }
+
+// AddSlave registers the slave with the given ROM ID with the kernel, e.g.
+// when automatic searches are disabled on a noisy bus. ROM IDs with a wrong
+// CRC are rejected with ErrCRC, the kernel would register them regardless.
+func (ms *Master) AddSlave(rom ROM) error {
+	log.Printf("W1 ADD SLAVE %v", rom)
+	if !rom.Valid() {
+		return fmt.Errorf("w1: slave %v: %w", rom, ErrCRC)
+	}
+	err := ms.addRemove(cmdSlaveAdd, rom)
+	if errors.Is(err, ErrInvalid) {
+		return fmt.Errorf("w1: slave %v is already registered: %w", rom, err)
+	}
+	return err
+}
+
+// RemoveSlave unregisters the slave with the given ROM ID from the kernel
+func (ms *Master) RemoveSlave(rom ROM) error {
+	log.Printf("W1 REMOVE SLAVE %v", rom)
+	err := ms.addRemove(cmdSlaveRemove, rom)
+	if errors.Is(err, ErrInvalid) {
+		return fmt.Errorf("w1: slave %v is not registered: %w", rom, err)
+	}
+	return err
+}
+
+func (ms *Master) addRemove(t cmdType, rom ROM) error {
+	s := &Slave{family: rom[0], crc: rom[7]}
+	copy(s.uid[:], rom[1:7])
+	regNum := make([]byte, 8)
+	s.putRegNum(regNum)
+
+	req, err := ms.cmd(t, regNum)
+	if err != nil {
+		return err
+	}
+	return ms.w1.send(req)
+}
+
+// Reset resets the bus. It fails if no device answers with a presence pulse.
+func (ms *Master) Reset() error {
+	log.Print("W1 RESET")
+	req, err := ms.cmd(cmdReset, nil)
+	if err != nil {
+		return err
+	}
+	return ms.w1.send(req)
+}
+
+// Write writes data to the bus. Unlike Slave.Write it is not preceded by a
+// reset and MATCH ROM, so it can e.g. address all devices with SKIP ROM.
+func (ms *Master) Write(data []byte) error {
+	log.Print("W1 WRITE MASTER")
+	req, err := ms.cmd(cmdWrite, data)
+	if err != nil {
+		return err
+	}
+	return ms.w1.send(req)
+}
+
+// Read reads n bytes from the bus, at most 8140 of which fit the reply
+func (ms *Master) Read(n int) ([]byte, error) {
+	log.Print("W1 READ MASTER")
+	return ms.io(cmdRead, make([]byte, n))
+}
+
+// Touch writes data to the bus bit by bit and returns the bits sampled
+// meanwhile, as needed for search algorithms. Like Read it takes at most
+// 8140 bytes.
+func (ms *Master) Touch(data []byte) ([]byte, error) {
+	log.Print("W1 TOUCH")
+	return ms.io(cmdTouch, data)
+}
+
+// cmd returns a request running a single command on the bus
+func (ms *Master) cmd(t cmdType, data []byte) (*msg, error) {
+	if l := msgHdrLen + cmdHdrLen + len(data); l > maxTxLen {
+		return nil, fmt.Errorf("%w: %v of %d bytes exceeds %d", ErrTxTooLarge, t, l, maxTxLen)
+	}
+	c := cmd{t, 0, data}
+	body, err := c.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &msg{masterCmd, 0, uint16(len(body)), ms, nil, 0, body}, nil
+}
+
+// io runs a command answered with data, and returns that data
+func (ms *Master) io(t cmdType, data []byte) ([]byte, error) {
+	// longer replies would be truncated by the receive buffer
+	if len(data) > maxReadLen {
+		return nil, fmt.Errorf("%w: %v of %d bytes exceeds %d", ErrTxTooLarge, t, len(data), maxReadLen)
+	}
+	req, err := ms.cmd(t, data)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := ms.w1.request(req, 1)
+	if err != nil {
+		return nil, err
+	}
+	m := msgs[0]
+	if len(m.data) < cmdHdrLen {
+		return nil, &netlink.ParseError{Layer: "w1", Err: netlink.ErrShortMessage, Want: cmdHdrLen, Have: len(m.data)}
+	}
+	return m.data[cmdHdrLen:], nil
+}
@@ -16,3 +16,217 @@
 // along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
 
 package w1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+)
+
+func TestListSlaves(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, err := parseW1Msg(req[20:])
+		assert(t, err == nil)
+		assert(t, m.w1Type == masterCmd)
+		assert(t, m.master.id == 1)
+
+		data := []byte{byte(cmdListSlaves), 0, 16, 0}
+		data = append(data, 0x41, 1, 2, 3, 4, 5, 6, 0x7a)
+		data = append(data, 0x28, 6, 5, 4, 3, 2, 1, 0x5b)
+		reply := &msg{masterCmd, 0, uint16(len(data)), m.master, nil, 0, data}
+		status := &msg{masterCmd, 0, 4, m.master, nil, 0, []byte{byte(cmdListSlaves), 0, 0, 0}}
+		return [][]byte{
+			cnReply(req, false, marshal(reply)),
+			cnReply(req, true, marshal(status)),
+		}
+	}}
+
+	ms := &Master{1, New(k)}
+	ss, err := ms.ListSlaves()
+	if err != nil {
+		t.Fatalf("could not list slaves: %v", err)
+	}
+
+	assert(t, len(ss) == 2)
+	assert(t, ss[0].IsFamily(0x41))
+	assert(t, ss[0].uid == [6]byte{1, 2, 3, 4, 5, 6})
+	assert(t, ss[1].IsFamily(0x28))
+	assert(t, ss[1].crc == 0x5b)
+}
+
+func TestListSlavesCRC(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, _ := parseW1Msg(req[20:])
+		// a bit of the first serial flipped on the way
+		data := []byte{byte(cmdListSlaves), 0, 16, 0,
+			0x41, 1, 2, 3, 4, 5, 7, 0x7a,
+			0x28, 6, 5, 4, 3, 2, 1, 0x5b}
+		reply := &msg{masterCmd, 0, uint16(len(data)), m.master, nil, 0, data}
+		status := &msg{masterCmd, 0, 4, m.master, nil, 0, []byte{byte(cmdListSlaves), 0, 0, 0}}
+		return [][]byte{
+			cnReply(req, false, marshal(reply)),
+			cnReply(req, true, marshal(status)),
+		}
+	}}
+
+	ms := &Master{1, New(k)}
+	ss, err := ms.ListSlaves()
+	assert(t, errors.Is(err, ErrCRC))
+	assert(t, len(ss) == 1 && ss[0].IsFamily(0x28))
+
+	// the valid slave is still found
+	rom := ss[0].ROM()
+	s, err := ms.Slave(rom)
+	assert(t, err == nil && s.ROM() == rom)
+}
+
+func TestSearch(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, err := parseW1Msg(req[20:])
+		assert(t, err == nil)
+		assert(t, m.w1Type == masterCmd)
+		search := cmdType(m.data[0])
+
+		status := &msg{masterCmd, 0, 4, m.master, nil, 0, []byte{byte(search), 0, 0, 0}}
+		if search == cmdAlarmSearch {
+			// nobody in alarm state, there is no reply
+			return [][]byte{cnReply(req, true, marshal(status))}
+		}
+
+		// the kernel splits large results across replies
+		first := []byte{byte(search), 0, 8, 0, 0x28, 1, 2, 3, 4, 5, 6, 0x9e}
+		second := []byte{byte(search), 0, 8, 0, 0x10, 6, 5, 4, 3, 2, 1, 0xbe}
+		return [][]byte{
+			cnReply(req, false, marshal(&msg{masterCmd, 0, uint16(len(first)), m.master, nil, 0, first})),
+			cnReply(req, false, marshal(&msg{masterCmd, 0, uint16(len(second)), m.master, nil, 0, second})),
+			cnReply(req, true, marshal(status)),
+		}
+	}}
+
+	ms := &Master{1, New(k)}
+	ss, err := ms.Search()
+	if err != nil {
+		t.Fatalf("could not search: %v", err)
+	}
+	assert(t, len(ss) == 2)
+	assert(t, ss[0].IsFamily(0x28) && ss[0].master == ms)
+	assert(t, ss[1].IsFamily(0x10) && ss[1].crc == 0xbe)
+
+	ss, err = ms.AlarmSearch()
+	if err != nil {
+		t.Fatalf("could not run alarm search: %v", err)
+	}
+	assert(t, len(ss) == 0)
+	assert(t, len(k.queue) == 0)
+}
+
+func TestBusPrimitives(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	var bus []byte
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, err := parseW1Msg(req[20:])
+		assert(t, err == nil)
+		// commands on the bus are master commands, without MATCH ROM
+		assert(t, m.w1Type == masterCmd && m.master.id == 1)
+
+		c, data := cmdType(m.data[0]), m.data[cmdHdrLen:]
+		status := cnReply(req, true, marshal(&msg{masterCmd, 0, 4, m.master, nil, 0, []byte{byte(c), 0, 0, 0}}))
+		switch c {
+		case cmdReset, cmdWrite:
+			bus = append(bus, byte(c))
+			bus = append(bus, data...)
+			return [][]byte{status}
+		case cmdRead, cmdTouch:
+			out := append([]byte{byte(c), 0, 0, 0}, data...)
+			out[2] = byte(len(data))
+			for i := range data {
+				out[cmdHdrLen+i] = 0xa0 + byte(i)
+			}
+			reply := &msg{masterCmd, 0, uint16(len(out)), m.master, nil, 0, out}
+			return [][]byte{cnReply(req, false, marshal(reply)), status}
+		}
+		return nil
+	}}
+
+	ms := &Master{1, New(k)}
+	assert(t, ms.Reset() == nil)
+	// SKIP ROM, CONVERT T
+	assert(t, ms.Write([]byte{0xcc, 0x44}) == nil)
+	assert(t, bytes.Equal(bus, []byte{byte(cmdReset), byte(cmdWrite), 0xcc, 0x44}))
+
+	data, err := ms.Read(2)
+	assert(t, err == nil && bytes.Equal(data, []byte{0xa0, 0xa1}))
+	data, err = ms.Touch([]byte{0xff, 0xff, 0xff})
+	assert(t, err == nil && bytes.Equal(data, []byte{0xa0, 0xa1, 0xa2}))
+	assert(t, len(k.queue) == 0)
+
+	// the reply would not fit the receive buffer, the request the connector
+	_, err = ms.Read(maxReadLen + 1)
+	assert(t, errors.Is(err, ErrTxTooLarge))
+	_, err = ms.Touch(make([]byte, maxReadLen+1))
+	assert(t, errors.Is(err, ErrTxTooLarge))
+	assert(t, errors.Is(ms.Write(make([]byte, maxTxLen)), ErrTxTooLarge))
+	assert(t, len(k.sent) == 4)
+}
+
+func TestResetNoPresence(t *testing.T) {
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, _ := parseW1Msg(req[20:])
+		// w1_reset_bus reports 1 without a presence pulse, sent as -1
+		status := &msg{masterCmd, 0xff, 4, m.master, nil, 0, []byte{byte(cmdReset), 0, 0, 0}}
+		return [][]byte{cnReply(req, true, marshal(status))}
+	}}
+
+	ms := &Master{1, New(k)}
+	err := ms.Reset()
+	assert(t, errors.Is(err, ErrNoPresence))
+	assert(t, errors.Is(err, ErrNoDevice))
+	assert(t, err.Error() == "w1: W1_CMD_RESET (command 0) failed with status 255: no presence pulse")
+}
+
+func TestAddRemoveSlave(t *testing.T) {
+	registered := map[ROM]bool{}
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, err := parseW1Msg(req[20:])
+		assert(t, err == nil)
+		c := cmdType(m.data[0])
+		assert(t, c == cmdSlaveAdd || c == cmdSlaveRemove)
+		assert(t, len(m.data) == cmdHdrLen+8)
+
+		// like w1_process_command_addremove
+		rom := romBytes(m.data[cmdHdrLen:])
+		var status uint8
+		if registered[rom] == (c == cmdSlaveAdd) {
+			status = uint8(syscall.EINVAL)
+		} else {
+			registered[rom] = c == cmdSlaveAdd
+		}
+		reply := &msg{masterCmd, status, 4, m.master, nil, 0, []byte{byte(c), 0, 0, 0}}
+		return [][]byte{cnReply(req, true, marshal(reply))}
+	}}
+
+	ms := &Master{1, New(k)}
+	rom := ROM{0x41, 0x34, 0xab, 0x12, 0, 0, 0, 0xb7}
+	assert(t, ms.AddSlave(rom) == nil)
+	assert(t, registered[rom])
+	assert(t, errors.Is(ms.AddSlave(rom), syscall.EINVAL))
+	corrupted := rom
+	corrupted[7] ^= 1
+	assert(t, errors.Is(ms.AddSlave(corrupted), ErrCRC))
+	assert(t, !registered[corrupted])
+
+	assert(t, ms.RemoveSlave(rom) == nil)
+	assert(t, !registered[rom])
+	assert(t, errors.Is(ms.RemoveSlave(rom), syscall.EINVAL))
+}
@@ -18,9 +18,10 @@
 package w1
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
+	"math"
+
+	"github.com/lambdasoup/go-netlink/netlink"
 )
 
 type msgType uint8
@@ -36,6 +37,23 @@ const (
 	listMasters
 )
 
+var msgTypeNames = []string{
+	"W1_SLAVE_ADD",
+	"W1_SLAVE_REMOVE",
+	"W1_MASTER_ADD",
+	"W1_MASTER_REMOVE",
+	"W1_MASTER_CMD",
+	"W1_SLAVE_CMD",
+	"W1_LIST_MASTERS",
+}
+
+func (t msgType) String() string {
+	if int(t) < len(msgTypeNames) {
+		return msgTypeNames[t]
+	}
+	return fmt.Sprintf("W1_MSG_%d", uint8(t))
+}
+
 // Msg is a 1-Wire message
 // From drivers/w1/w1_netlink.h
 type msg struct {
@@ -53,57 +71,62 @@ func (m *msg) String() string {
 		m.w1Type, m.status, len(m.data), m.master, m.slave, m.data)
 }
 
-func parseW1Msg(bs []byte) msg {
-	msg := msg{}
-	buf := bytes.NewBuffer(bs)
+func parseW1Msg(bs []byte) (msg, error) {
+	m := msg{}
+	err := m.UnmarshalBinary(bs)
+	return m, err
+}
 
-	binary.Read(buf, binary.LittleEndian, &msg.w1Type)
-	binary.Read(buf, binary.LittleEndian, &msg.status)
-	binary.Read(buf, binary.LittleEndian, &msg.len)
+// UnmarshalBinary reads a message from the start of bs. The message's data
+// refers to bs and is not copied.
+func (m *msg) UnmarshalBinary(bs []byte) error {
+	if len(bs) < msgHdrLen {
+		return &netlink.ParseError{Layer: "w1", Err: netlink.ErrShortMessage, Want: msgHdrLen, Have: len(bs)}
+	}
+	m.w1Type = msgType(bs[0])
+	m.status = bs[1]
+	m.len = netlink.NativeEndian.Uint16(bs[2:])
 
 	// master or slave id depending on msg type
-	switch msg.w1Type {
+	switch m.w1Type {
 	case slaveAdd, slaveRemove, slaveCmd:
-		msg.slave = new(Slave)
-		binary.Read(buf, binary.LittleEndian, &msg.slave.family)
-		binary.Read(buf, binary.LittleEndian, &msg.slave.uid)
-		binary.Read(buf, binary.LittleEndian, &msg.slave.crc)
-
+		m.slave = parseSlave(bs[4:12])
 	case masterAdd, masterRemove, masterCmd:
-		msg.master = new(Master)
-		binary.Read(buf, binary.LittleEndian, &msg.master.id)
-		buf.Next(4)
-
-	case listMasters:
-		buf.Next(8)
+		m.master = &Master{id: netlink.NativeEndian.Uint32(bs[4:])}
+		m.res = netlink.NativeEndian.Uint32(bs[8:])
 	}
 
-	msg.data = make([]byte, msg.len)
-	buf.Read(msg.data)
-
-	return msg
+	if msgHdrLen+int(m.len) > len(bs) {
+		return &netlink.ParseError{Layer: "w1", Err: netlink.ErrShortMessage, Want: msgHdrLen + int(m.len), Have: len(bs)}
+	}
+	m.data = bs[msgHdrLen : msgHdrLen+int(m.len)]
+	return nil
 }
 
-func (m *msg) toBytes() []byte {
-	buf := new(bytes.Buffer)
-
-	binary.Write(buf, binary.LittleEndian, m.w1Type)
-	binary.Write(buf, binary.LittleEndian, m.status)
-	binary.Write(buf, binary.LittleEndian, m.len)
+// AppendBinary appends the wire format of m to b. The length is taken from
+// the data.
+func (m *msg) AppendBinary(b []byte) ([]byte, error) {
+	if len(m.data) > math.MaxUint16 {
+		return b, fmt.Errorf("w1: message data of %d bytes exceeds the maximum of %d", len(m.data), math.MaxUint16)
+	}
+	n := len(b)
+	b = append(b, make([]byte, msgHdrLen)...)
+	b[n] = byte(m.w1Type)
+	b[n+1] = m.status
+	netlink.NativeEndian.PutUint16(b[n+2:], uint16(len(m.data)))
 	// some messages do not have a master set
 	if m.master != nil {
-		binary.Write(buf, binary.LittleEndian, m.master.id)
-		binary.Write(buf, binary.LittleEndian, m.res)
+		netlink.NativeEndian.PutUint32(b[n+4:], m.master.id)
+		netlink.NativeEndian.PutUint32(b[n+8:], m.res)
 	} else if m.slave != nil {
-		binary.Write(buf, binary.LittleEndian, m.slave.family)
-		binary.Write(buf, binary.LittleEndian, m.slave.uid)
-		binary.Write(buf, binary.LittleEndian, m.slave.crc)
+		m.slave.putRegNum(b[n+4:])
 	} else {
-		binary.Write(buf, binary.LittleEndian, uint32(0))
-		binary.Write(buf, binary.LittleEndian, m.res)
+		netlink.NativeEndian.PutUint32(b[n+8:], m.res)
 	}
+	return append(b, m.data...), nil
+}
 
-	buf.Write(m.data)
-
-	return buf.Bytes()
+// MarshalBinary returns the wire format of m
+func (m *msg) MarshalBinary() ([]byte, error) {
+	return m.AppendBinary(make([]byte, 0, msgHdrLen+len(m.data)))
 }
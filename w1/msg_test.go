@@ -16,3 +16,78 @@
 // along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
 
 package w1
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+func TestMsgByteOrders(t *testing.T) {
+	for _, order := range nltest.ByteOrders {
+		t.Run(order.String(), func(t *testing.T) {
+			nltest.UseByteOrder(t, order)
+
+			c := cmd{cmdRead, 0, make([]byte, 300)}
+			m := &msg{masterCmd, 0, uint16(len(marshal(&c))), &Master{id: 0x01020304}, nil, 0, marshal(&c)}
+			bs := marshal(m)
+			assert(t, order.Uint16(bs[2:]) == 304)
+			assert(t, order.Uint32(bs[4:]) == 0x01020304)
+			assert(t, order.Uint16(bs[msgHdrLen+2:]) == 300)
+
+			parsed, err := parseW1Msg(bs)
+			assert(t, err == nil)
+			assert(t, parsed.w1Type == masterCmd)
+			assert(t, parsed.len == m.len)
+			assert(t, parsed.master.id == m.master.id)
+			assert(t, bytes.Equal(parsed.data, m.data))
+		})
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	bs := marshal(&msg{masterCmd, 0, 3, &Master{id: 1}, nil, 0, []byte{1, 2, 3}})
+
+	m := &msg{}
+	assert(t, m.UnmarshalBinary(bs) == nil)
+	assert(t, errors.Is(m.UnmarshalBinary(bs[:msgHdrLen-1]), netlink.ErrShortMessage))
+	assert(t, errors.Is(m.UnmarshalBinary(bs[:len(bs)-1]), netlink.ErrShortMessage))
+
+	_, err := (&cmd{cmdWrite, 0, make([]byte, 1<<16)}).MarshalBinary()
+	assert(t, err != nil)
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	f.Add(marshal(&msg{masterCmd, 0, 3, &Master{id: 1}, nil, 0, []byte{1, 2, 3}}))
+	f.Add(marshal(&msg{slaveCmd, 0, 0, nil, &Slave{family: 0x41}, 0, nil}))
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		m := &msg{}
+		if m.UnmarshalBinary(bs) != nil {
+			return
+		}
+		if len(m.data) != int(m.len) {
+			t.Errorf("parsed %d bytes of data for length %d", len(m.data), m.len)
+		}
+	})
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	m := &msg{slaveCmd, 0, 64, nil, &Slave{family: 0x41}, 0, make([]byte, 64)}
+	buf := make([]byte, 0, 128)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = m.AppendBinary(buf[:0])
+	}
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	bs := marshal(&msg{masterCmd, 0, 64, &Master{id: 1}, nil, 0, make([]byte, 64)})
+	m := &msg{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m.UnmarshalBinary(bs)
+	}
+}
@@ -0,0 +1,113 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrCRC is returned for ROM IDs whose CRC does not match
+var ErrCRC = errors.New("w1: ROM CRC mismatch")
+
+// ROM is the 64 bit ID of a 1-Wire slave: its family code, 48 bit serial
+// number and CRC8, in the order they are read from the bus
+type ROM [8]byte
+
+// ParseROM parses a ROM ID in the kernel's sysfs format family-serial, e.g.
+// "41-00000012ab34". The CRC is computed.
+func ParseROM(s string) (ROM, error) {
+	var r ROM
+	err := r.UnmarshalText([]byte(s))
+	return r, err
+}
+
+// Family returns the family code
+func (r ROM) Family() byte {
+	return r[0]
+}
+
+// Serial returns the 48 bit serial number
+func (r ROM) Serial() uint64 {
+	var bs [8]byte
+	copy(bs[:], r[1:7])
+	return binary.LittleEndian.Uint64(bs[:])
+}
+
+// CRC returns the CRC8 stored in the ROM
+func (r ROM) CRC() byte {
+	return r[7]
+}
+
+// Valid returns true if the stored CRC matches family code and serial
+func (r ROM) Valid() bool {
+	return crc8(r[:7]) == r[7]
+}
+
+// String returns the ROM ID in the kernel's sysfs format
+func (r ROM) String() string {
+	return fmt.Sprintf("%02x-%012x", r.Family(), r.Serial())
+}
+
+// MarshalText returns the ROM ID in the kernel's sysfs format
+func (r ROM) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText parses a ROM ID in the kernel's sysfs format and computes
+// its CRC
+func (r *ROM) UnmarshalText(text []byte) error {
+	s := string(text)
+	family, serial, ok := strings.Cut(s, "-")
+	if !ok || len(family) != 2 || len(serial) != 12 {
+		return fmt.Errorf("w1: invalid ROM ID %q", s)
+	}
+	f, err := strconv.ParseUint(family, 16, 8)
+	if err != nil {
+		return fmt.Errorf("w1: invalid ROM ID %q", s)
+	}
+	n, err := strconv.ParseUint(serial, 16, 48)
+	if err != nil {
+		return fmt.Errorf("w1: invalid ROM ID %q", s)
+	}
+
+	var bs [8]byte
+	binary.LittleEndian.PutUint64(bs[:], n)
+	r[0] = byte(f)
+	copy(r[1:7], bs[:6])
+	r[7] = crc8(r[:7])
+	return nil
+}
+
+// crc8 computes the Dallas/Maxim 1-Wire CRC8, polynomial x^8 + x^5 + x^4 + 1
+func crc8(data []byte) (crc byte) {
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8c
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return
+}
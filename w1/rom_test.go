@@ -0,0 +1,74 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestROM(t *testing.T) {
+	// a DS1922L as read from the bus
+	rom := ROM{0x41, 0x34, 0xab, 0x12, 0, 0, 0, 0xb7}
+	assert(t, rom.Valid())
+	assert(t, rom.Family() == 0x41)
+	assert(t, rom.Serial() == 0x12ab34)
+	assert(t, rom.CRC() == 0xb7)
+	assert(t, rom.String() == "41-00000012ab34")
+
+	parsed, err := ParseROM("41-00000012ab34")
+	assert(t, err == nil && parsed == rom)
+
+	// the example of Maxim application note 27
+	parsed, err = ParseROM("02-00000001b81c")
+	assert(t, err == nil && parsed.CRC() == 0xa2)
+
+	for _, s := range []string{"", "41", "41-", "4100000012ab34", "x1-00000012ab34", "41-00000012ab3g", "141-0000012ab34"} {
+		_, err := ParseROM(s)
+		assert(t, err != nil)
+	}
+
+	corrupted := rom
+	corrupted[3] ^= 0x10
+	assert(t, !corrupted.Valid())
+
+	slave := &Slave{0x41, [6]byte{0x34, 0xab, 0x12}, 0xb7, nil}
+	assert(t, slave.ROM() == rom)
+	assert(t, slave.String() == "Slave{41-00000012ab34}")
+}
+
+func TestROMJSON(t *testing.T) {
+	config := struct {
+		Logger ROM
+		Spares []ROM
+	}{
+		Logger: ROM{0x41, 0x34, 0xab, 0x12, 0, 0, 0, 0xb7},
+		Spares: []ROM{{0x28, 1, 2, 3, 4, 5, 6, 0x9e}},
+	}
+
+	bs, err := json.Marshal(config)
+	assert(t, err == nil)
+	assert(t, string(bs) == `{"Logger":"41-00000012ab34","Spares":["28-060504030201"]}`)
+
+	config.Logger, config.Spares = ROM{}, nil
+	assert(t, json.Unmarshal(bs, &config) == nil)
+	assert(t, config.Logger.String() == "41-00000012ab34" && config.Logger.Valid())
+	assert(t, len(config.Spares) == 1 && config.Spares[0].CRC() == 0x9e)
+
+	assert(t, json.Unmarshal([]byte(`{"Logger":"41-xyz"}`), &config) != nil)
+}
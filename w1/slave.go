@@ -17,7 +17,12 @@
 
 package w1
 
-import "fmt"
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lambdasoup/go-netlink/netlink"
+)
 
 // Slave is a 1-Wire slave device
 type Slave struct {
@@ -27,6 +32,40 @@ type Slave struct {
 	master *Master
 }
 
+// romBytes converts a struct w1_reg_num to the ROM bytes family, serial
+// and crc. The kernel declares it as 64 bit bitfield, so it is laid out in
+// host byte order with the family in the least significant byte.
+func romBytes(regNum []byte) (rom ROM) {
+	binary.LittleEndian.PutUint64(rom[:], netlink.NativeEndian.Uint64(regNum))
+	return
+}
+
+// parseSlave reads the Slave identified by the given struct w1_reg_num
+func parseSlave(regNum []byte) *Slave {
+	rom := romBytes(regNum)
+	s := &Slave{family: rom[0], crc: rom[7]}
+	copy(s.uid[:], rom[1:7])
+	return s
+}
+
+// putRegNum writes the struct w1_reg_num identifying this Slave to b
+func (s *Slave) putRegNum(b []byte) {
+	rom := uint64(s.family) | uint64(s.crc)<<56
+	for i, u := range s.uid {
+		rom |= uint64(u) << (8 * uint(i+1))
+	}
+	netlink.NativeEndian.PutUint64(b, rom)
+}
+
+// ROM returns the ROM ID of this Slave. Listings and searches only return
+// slaves with a valid ROM ID.
+func (s *Slave) ROM() (rom ROM) {
+	rom[0] = s.family
+	copy(rom[1:7], s.uid[:])
+	rom[7] = s.crc
+	return
+}
+
 // Close this Slave's 1-Wire connection
 func (s *Slave) Close() {
 	s.master.Close()
@@ -38,7 +77,7 @@ func (s *Slave) IsFamily(family byte) bool {
 }
 
 func (s *Slave) String() string {
-	return fmt.Sprintf("Slave{Family:%x, UID:%x}", s.family, s.uid)
+	return fmt.Sprintf("Slave{%v}", s.ROM())
 }
 
 func (s *Slave) Read(data []byte, pages int) ([]byte, error) {
@@ -16,3 +16,38 @@
 // along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
 
 package w1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+)
+
+func TestRegNum(t *testing.T) {
+	slave := &Slave{0x41, [6]byte{0x34, 0xab, 0x12, 0, 0, 0}, 0xb7, nil}
+	rom := []byte{0x41, 0x34, 0xab, 0x12, 0, 0, 0, 0xb7}
+	// w1_reg_num is a 64 bit bitfield, reversed on big endian hosts
+	wire := map[binary.ByteOrder][]byte{
+		binary.LittleEndian: rom,
+		binary.BigEndian:    {0xb7, 0, 0, 0, 0x12, 0xab, 0x34, 0x41},
+	}
+
+	for order, bs := range wire {
+		t.Run(order.String(), func(t *testing.T) {
+			nltest.UseByteOrder(t, order)
+
+			regNum := make([]byte, 8)
+			slave.putRegNum(regNum)
+			assert(t, bytes.Equal(regNum, bs))
+			r := romBytes(bs)
+			assert(t, bytes.Equal(r[:], rom))
+
+			parsed := parseSlave(bs)
+			assert(t, parsed.family == slave.family)
+			assert(t, parsed.uid == slave.uid)
+			assert(t, parsed.crc == slave.crc)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Errors reported by the kernel for failed commands, see StatusError
+var (
+	// ErrNoDevice is reported when the slave did not answer, e.g. when an
+	// iButton was taken off the reader
+	ErrNoDevice error = syscall.ENODEV
+	// ErrInvalid is reported for malformed or unsupported commands
+	ErrInvalid error = syscall.EINVAL
+	// ErrNoMemory is reported when the kernel could not allocate a reply
+	ErrNoMemory error = syscall.ENOMEM
+	// ErrTimeout is reported when the bus master timed out
+	ErrTimeout error = syscall.ETIMEDOUT
+	// ErrNoPresence is reported when no device answered a bus reset. It
+	// also matches ErrNoDevice.
+	ErrNoPresence = errors.New("no presence pulse")
+)
+
+// statusNoPresence is the status of a reset without presence pulse, for
+// which w1_reset_bus returns 1 rather than an errno
+const statusNoPresence = 0xff
+
+// StatusError is a command the kernel reported as failed. It wraps the
+// syscall.Errno of the failure.
+type StatusError struct {
+	// Cmd is the name of the failed command, e.g. W1_CMD_READ, empty for
+	// messages without commands
+	Cmd string
+	// Index is the position of the failed command in its message
+	Index int
+	Errno syscall.Errno
+}
+
+// newStatusError returns the error of the given status reply, the index-th
+// of its request. The kernel reports the negated errno as status.
+func newStatusError(m *msg, index int) *StatusError {
+	e := &StatusError{Index: index, Errno: syscall.Errno(m.status)}
+	if len(m.data) >= cmdHdrLen {
+		e.Cmd = cmdType(m.data[0]).String()
+	}
+	return e
+}
+
+func (e *StatusError) Error() string {
+	if e.Cmd == "" {
+		return fmt.Sprintf("w1: status %d: %v", uint8(e.Errno), e.Unwrap())
+	}
+	return fmt.Sprintf("w1: %s (command %d) failed with status %d: %v", e.Cmd, e.Index, uint8(e.Errno), e.Unwrap())
+}
+
+// Unwrap returns the Errno, or ErrNoPresence for a reset nobody answered
+func (e *StatusError) Unwrap() error {
+	if e.Errno == statusNoPresence {
+		return ErrNoPresence
+	}
+	return e.Errno
+}
+
+// Is reports a reset nobody answered as ErrNoDevice, too
+func (e *StatusError) Is(target error) bool {
+	return e.Errno == statusNoPresence && target == ErrNoDevice
+}
@@ -0,0 +1,44 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, _ := parseW1Msg(req[20:])
+		// the write succeeds, then the iButton is gone
+		ok := &msg{slaveCmd, 0, 4, nil, m.slave, 0, []byte{byte(cmdWrite), 0, 0, 0}}
+		gone := &msg{slaveCmd, uint8(syscall.ENODEV), 4, nil, m.slave, 0, []byte{byte(cmdRead), 0, 0, 0}}
+		return [][]byte{cnReply(req, true, marshal(ok)), cnReply(req, true, marshal(gone))}
+	}}
+	s := &Slave{family: 0x41, master: &Master{1, New(k)}}
+
+	_, err := s.Tx().Write([]byte{0xf0}).Read(1).Run()
+	assert(t, errors.Is(err, ErrNoDevice))
+	assert(t, !errors.Is(err, ErrInvalid))
+
+	var se *StatusError
+	assert(t, errors.As(err, &se))
+	assert(t, se.Cmd == "W1_CMD_READ" && se.Index == 1)
+	assert(t, se.Error() == "w1: W1_CMD_READ (command 1) failed with status 19: no such device")
+}
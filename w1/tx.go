@@ -0,0 +1,327 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/lambdasoup/go-netlink/log"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// maxTxLen limits the w1 messages sent in one request. The connector
+// rejects requests larger than CONNECTOR_MAX_MSG_SIZE, 16384 bytes
+// including its header, from include/linux/connector.h.
+const maxTxLen = 16384 - cnMsgHdrLen
+
+// maxReadLen limits the bytes of one read or touch. The kernel answers with
+// all of them in one datagram, which has to fit the 8192 bytes receive
+// buffer of netlink.Socket along with the netlink, connector, w1 message
+// and command headers.
+const maxReadLen = 8192 - syscall.NLMSG_HDRLEN - cnMsgHdrLen - msgHdrLen - cmdHdrLen
+
+// from include/uapi/linux/connector.h
+const cnMsgHdrLen = 20
+
+// ErrTxTooLarge is returned by Run for commands between two resets which do
+// not fit one request, unless the Tx allows splitting them, and by the bus
+// primitives of Master for data too large for a request or reply
+var ErrTxTooLarge = errors.New("w1: transaction too large for one message")
+
+// Tx is a sequence of commands run on a Slave. The kernel resets the bus
+// and selects the slave with MATCH ROM before the first command and after
+// each Reset.
+//
+// Transactions too large for one request are sent in several, split at
+// resets. The kernel runs the requests one at a time, other users of the
+// bus may interleave in between.
+type Tx struct {
+	slave *Slave
+	cmds  []cmd
+	split bool
+}
+
+// Tx starts a transaction on this Slave
+func (s *Slave) Tx() *Tx {
+	return &Tx{slave: s}
+}
+
+// Write adds writing data to the bus
+func (tx *Tx) Write(data []byte) *Tx {
+	tx.cmds = append(tx.cmds, cmd{cmdWrite, 0, data})
+	return tx
+}
+
+// Read adds reading n bytes from the bus
+func (tx *Tx) Read(n int) *Tx {
+	tx.cmds = append(tx.cmds, cmd{cmdRead, 0, make([]byte, n)})
+	return tx
+}
+
+// Touch adds writing data bit by bit while sampling the bus
+func (tx *Tx) Touch(data []byte) *Tx {
+	tx.cmds = append(tx.cmds, cmd{cmdTouch, 0, data})
+	return tx
+}
+
+// Reset adds a bus reset followed by MATCH ROM, selecting the slave again
+func (tx *Tx) Reset() *Tx {
+	tx.cmds = append(tx.cmds, cmd{cmdReset, 0, nil})
+	return tx
+}
+
+// AllowSplit lets Run split commands too large for one request between two
+// resets. Their rest is sent without selecting the slave again, so it
+// reaches the wrong device if anything else uses the bus in between, such
+// as the kernel's automatic search. Only for buses without other users.
+func (tx *Tx) AllowSplit() *Tx {
+	tx.split = true
+	return tx
+}
+
+// Run sends the transaction and returns the result of each command, in the
+// order they were added. Reads and touches yield the bytes sampled,
+// writes and resets nil. The requests of a transaction are sent at once,
+// so like the commands within a request they run even after an earlier
+// command failed.
+func (tx *Tx) Run() ([][]byte, error) {
+	log.Printf("W1 TX: %d commands", len(tx.cmds))
+
+	chunks, err := tx.chunks()
+	if err != nil {
+		return nil, err
+	}
+	reqs := make([][]*msg, len(chunks))
+	sents := make([][]piece, len(chunks))
+	for i, chunk := range chunks {
+		reqs[i], sents[i], err = tx.messages(chunk, i > 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	w1 := tx.slave.master.w1
+	ids, err := w1.sendAll(reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]byte, len(tx.cmds))
+	for i, sent := range sents {
+		replies := 0
+		for _, p := range sent {
+			if p.c.answered() {
+				replies++
+			}
+		}
+
+		// every command is confirmed by a status, reads and touches are
+		// answered before it
+		msgs, err := w1.collect(ids[i], len(sent), replies)
+		if err != nil {
+			var se *StatusError
+			if errors.As(err, &se) && se.Index < len(sent) {
+				se.Index = sent[se.Index].index
+			}
+			return nil, err
+		}
+
+		for _, p := range sent {
+			if !p.c.answered() {
+				continue
+			}
+			m := msgs[0]
+			msgs = msgs[1:]
+			if len(m.data) < cmdHdrLen {
+				return nil, &netlink.ParseError{Layer: "w1", Err: netlink.ErrShortMessage, Want: cmdHdrLen, Have: len(m.data)}
+			}
+			if t := cmdType(m.data[0]); t != p.c.cmd {
+				return nil, fmt.Errorf("w1: reply to %v where %v was expected", t, p.c.cmd)
+			}
+			results[p.index] = append(results[p.index], m.data[cmdHdrLen:]...)
+		}
+	}
+	return results, nil
+}
+
+// messages returns the w1 messages of a chunk and the commands sent in
+// them. The kernel rejects W1_CMD_RESET in slave messages, but resets the
+// bus and selects the slave before the commands of each, so every reset
+// starts a new slave message instead. A chunk continuing the previous one
+// starts with a master message, which does not select the slave.
+func (tx *Tx) messages(chunk []piece, cont bool) (msgs []*msg, sent []piece, err error) {
+	var m *msg
+	for _, p := range chunk {
+		if m == nil || p.c.cmd == cmdReset {
+			if m == nil && cont && p.c.cmd != cmdReset {
+				m = &msg{masterCmd, 0, 0, tx.slave.master, nil, 0, nil}
+			} else {
+				m = &msg{slaveCmd, 0, 0, nil, tx.slave, 0, nil}
+			}
+			msgs = append(msgs, m)
+			if p.c.cmd == cmdReset {
+				continue
+			}
+		}
+		m.data, err = p.c.AppendBinary(m.data)
+		if err != nil {
+			return nil, nil, err
+		}
+		sent = append(sent, p)
+	}
+	for _, m := range msgs {
+		m.len = uint16(len(m.data))
+	}
+	return
+}
+
+// piece is a command sent in one message, or a part of it
+type piece struct {
+	c cmd
+	// index of the command in the Tx
+	index int
+}
+
+// len returns the bytes p takes in a message. Resets take none, they start
+// a new message instead.
+func (p *piece) len() int {
+	if p.c.cmd == cmdReset {
+		return 0
+	}
+	return cmdHdrLen + len(p.c.data)
+}
+
+// pieces returns the commands of the Tx, with reads and touches split into
+// parts whose replies fit a datagram. The parts run back to back in one
+// message, which has the same effect on the bus.
+func (tx *Tx) pieces() (ps []piece) {
+	for i, c := range tx.cmds {
+		data := c.data
+		for c.answered() && len(data) > maxReadLen {
+			ps = append(ps, piece{cmd{c.cmd, c.res, data[:maxReadLen]}, i})
+			data = data[maxReadLen:]
+		}
+		ps = append(ps, piece{cmd{c.cmd, c.res, data}, i})
+	}
+	return
+}
+
+// chunks distributes the commands over requests of at most maxTxLen bytes
+// of w1 messages. Requests start at a reset, unless the Tx allows
+// splitting.
+func (tx *Tx) chunks() ([][]piece, error) {
+	if tx.split {
+		return tx.splitChunks(), nil
+	}
+
+	// the commands from one reset to the next, sent in one slave message
+	var segments [][]piece
+	var seg []piece
+	for _, p := range tx.pieces() {
+		if p.c.cmd == cmdReset && len(seg) > 0 {
+			segments = append(segments, seg)
+			seg = nil
+		}
+		seg = append(seg, p)
+	}
+	if len(seg) > 0 {
+		segments = append(segments, seg)
+	}
+
+	var chunks [][]piece
+	var chunk []piece
+	n := 0
+	for _, seg := range segments {
+		l := msgHdrLen
+		for _, p := range seg {
+			l += p.len()
+		}
+		if l > maxTxLen {
+			return nil, fmt.Errorf("%w: %d bytes of commands between resets exceed %d", ErrTxTooLarge, l, maxTxLen)
+		}
+		if n+l > maxTxLen {
+			chunks = append(chunks, chunk)
+			chunk, n = nil, 0
+		}
+		chunk = append(chunk, seg...)
+		n += l
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// splitChunks distributes the commands over requests of at most maxTxLen
+// bytes of w1 messages, filling each. Commands too large for a request are
+// split, as running their parts back to back has the same effect on the
+// bus. Their rest continues in a master message.
+func (tx *Tx) splitChunks() (chunks [][]piece) {
+	var chunk []piece
+	n := 0
+	for _, p := range tx.pieces() {
+		if p.c.cmd == cmdReset {
+			// starts a slave message, leaving room for a command
+			if n+msgHdrLen+cmdHdrLen+1 > maxTxLen {
+				chunks = append(chunks, chunk)
+				chunk, n = nil, 0
+			}
+			chunk = append(chunk, p)
+			n += msgHdrLen
+			continue
+		}
+
+		data := p.c.data
+		for {
+			if len(chunk) == 0 {
+				// the first message of a request
+				n = msgHdrLen
+			}
+			// room for the header and at least one byte of data
+			need := cmdHdrLen
+			if len(data) > 0 {
+				need++
+			}
+			if n+need > maxTxLen {
+				chunks = append(chunks, chunk)
+				chunk, n = nil, 0
+				continue
+			}
+			k := maxTxLen - n - cmdHdrLen
+			if k > len(data) {
+				k = len(data)
+			}
+			chunk = append(chunk, piece{cmd{p.c.cmd, p.c.res, data[:k]}, p.index})
+			n += cmdHdrLen + k
+			data = data[k:]
+			if len(data) == 0 {
+				break
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return
+}
+
+// answered returns true for commands the kernel replies to with data
+func (c *cmd) answered() bool {
+	return c.cmd == cmdRead || c.cmd == cmdTouch
+}
@@ -0,0 +1,228 @@
+// This file is part of go-netlink.
+//
+// Copyright (C) 2015 Max Hille <mh@lambdasoup.com>
+//
+// go-netlink is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// go-netlink is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// txKernel runs the commands of requests on a bus recording writes and
+// resets, and answering reads and touches with increasing bytes. Slave
+// messages start with a reset and MATCH ROM, recorded as reset and 0x55,
+// and reject W1_CMD_RESET like the kernel. The types of the messages are
+// recorded in msgs.
+func txKernel(t *testing.T, bus *[]byte, msgs *[]msgType) *fakeKernel {
+	next := byte(0xa0)
+	return &fakeKernel{handle: func(req []byte) [][]byte {
+		assert(t, len(req[20:]) <= maxTxLen)
+
+		var out [][]byte
+		for w1 := req[20:]; len(w1) > 0; {
+			m, err := parseW1Msg(w1)
+			assert(t, err == nil)
+			assert(t, m.w1Type == slaveCmd && m.slave.family == 0x41 ||
+				m.w1Type == masterCmd && m.master.id == 1)
+			w1 = w1[msgHdrLen+len(m.data):]
+			*msgs = append(*msgs, m.w1Type)
+			if m.w1Type == slaveCmd {
+				*bus = append(*bus, byte(cmdReset), 0x55)
+			}
+
+			for body := m.data; len(body) >= cmdHdrLen; {
+				c := cmdType(body[0])
+				n := int(netlink.NativeEndian.Uint16(body[2:]))
+				data := body[cmdHdrLen : cmdHdrLen+n]
+				body = body[cmdHdrLen+n:]
+
+				var status uint8
+				switch {
+				case c == cmdReset && m.w1Type == slaveCmd:
+					status = uint8(syscall.EINVAL)
+				case c == cmdReset, c == cmdWrite:
+					*bus = append(*bus, byte(c))
+					*bus = append(*bus, data...)
+				case c == cmdRead, c == cmdTouch:
+					assert(t, n <= maxReadLen)
+					res := append([]byte{byte(c), 0, 0, 0}, data...)
+					netlink.NativeEndian.PutUint16(res[2:], uint16(n))
+					for i := range data {
+						res[cmdHdrLen+i] = next
+						next++
+					}
+					reply := &msg{m.w1Type, 0, uint16(len(res)), m.master, m.slave, 0, res}
+					out = append(out, cnReply(req, false, marshal(reply)))
+				}
+				reply := &msg{m.w1Type, status, 4, m.master, m.slave, 0, []byte{byte(c), 0, 0, 0}}
+				out = append(out, cnReply(req, true, marshal(reply)))
+			}
+		}
+		return out
+	}}
+}
+
+// batchKernel is a fakeKernel taking requests in batches, like
+// netlink.Socket
+type batchKernel struct {
+	*fakeKernel
+	queued  [][]byte
+	flushes int
+}
+
+func (k *batchKernel) Queue(msgType uint16, flags uint16, data []byte) {
+	k.queued = append(k.queued, data)
+}
+
+func (k *batchKernel) Flush() error {
+	k.flushes++
+	for _, data := range k.queued {
+		k.Send(data)
+	}
+	k.queued = nil
+	return nil
+}
+
+func TestTx(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	var bus []byte
+	var msgs []msgType
+	k := txKernel(t, &bus, &msgs)
+	s := &Slave{family: 0x41, master: &Master{1, New(k)}}
+
+	results, err := s.Tx().
+		Write([]byte{0x0f, 0x00, 0x02}).
+		Read(2).
+		Reset().
+		Touch([]byte{0xff}).
+		Run()
+	assert(t, err == nil)
+	assert(t, len(results) == 4)
+	assert(t, results[0] == nil && results[2] == nil)
+	assert(t, bytes.Equal(results[1], []byte{0xa0, 0xa1}))
+	assert(t, bytes.Equal(results[3], []byte{0xa2}))
+	// one request, selecting the slave again for the touch
+	assert(t, bytes.Equal(bus, []byte{byte(cmdReset), 0x55, byte(cmdWrite), 0x0f, 0x00, 0x02, byte(cmdReset), 0x55}))
+	assert(t, len(k.sent) == 1)
+	assert(t, len(msgs) == 2 && msgs[0] == slaveCmd && msgs[1] == slaveCmd)
+	assert(t, len(k.queue) == 0)
+}
+
+func TestTxSplitAtReset(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	var bus []byte
+	var msgs []msgType
+	k := txKernel(t, &bus, &msgs)
+	bk := &batchKernel{fakeKernel: k}
+	s := &Slave{family: 0x41, master: &Master{1, New(bk)}}
+
+	// two READ MEMORY commands of 10000 bytes each, too large for one
+	// request, and each answered in two replies
+	results, err := s.Tx().Write([]byte{0xf0, 0x00, 0x10}).Read(10000).
+		Reset().Write([]byte{0xf0, 0x10, 0x37}).Read(10000).Run()
+	assert(t, err == nil)
+	assert(t, len(results) == 5)
+	assert(t, len(results[1]) == 10000 && len(results[4]) == 10000)
+	for i, b := range results[1] {
+		assert(t, b == byte(0xa0+i))
+	}
+
+	// both requests select the slave, and are sent at once
+	assert(t, len(k.sent) == 2 && bk.flushes == 1)
+	assert(t, len(msgs) == 2 && msgs[0] == slaveCmd && msgs[1] == slaveCmd)
+	assert(t, len(k.queue) == 0)
+}
+
+func TestTxTooLarge(t *testing.T) {
+	var bus []byte
+	var msgs []msgType
+	k := txKernel(t, &bus, &msgs)
+	s := &Slave{family: 0x41, master: &Master{1, New(k)}}
+
+	_, err := s.Tx().Write([]byte{0xf0, 0x00, 0x10}).Read(20000).Run()
+	assert(t, errors.Is(err, ErrTxTooLarge))
+	assert(t, len(msgs) == 0)
+}
+
+func TestTxAllowSplit(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	var bus []byte
+	var msgs []msgType
+	k := txKernel(t, &bus, &msgs)
+	s := &Slave{family: 0x41, master: &Master{1, New(k)}}
+
+	write := []byte{0xf0, 0x00, 0x10}
+	results, err := s.Tx().AllowSplit().Write(write).Read(20000).Reset().Read(2).Run()
+	assert(t, err == nil)
+	assert(t, len(results) == 4 && results[0] == nil && results[2] == nil)
+	assert(t, len(results[1]) == 20000)
+	for i, b := range results[1] {
+		assert(t, b == byte(0xa0+i))
+	}
+	next := byte(0xa0 + len(results[1]))
+	assert(t, bytes.Equal(results[3], []byte{next, next + 1}))
+	assert(t, bytes.Equal(bus, append(append([]byte{byte(cmdReset), 0x55, byte(cmdWrite)}, write...), byte(cmdReset), 0x55)))
+
+	// the read continues through the master in a second request, the reset
+	// starts a slave message again
+	assert(t, len(k.sent) == 2)
+	assert(t, len(msgs) == 3 && msgs[0] == slaveCmd && msgs[1] == masterCmd && msgs[2] == slaveCmd)
+	assert(t, len(k.queue) == 0)
+}
+
+func TestTxSplitStatus(t *testing.T) {
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, _ := parseW1Msg(req[20:])
+		if m.w1Type == slaveCmd {
+			status := &msg{slaveCmd, 0, 4, nil, m.slave, 0, []byte{byte(cmdWrite), 0, 0, 0}}
+			return [][]byte{cnReply(req, true, marshal(status))}
+		}
+		// the continuation fails
+		status := &msg{masterCmd, uint8(syscall.ENODEV), 4, m.master, nil, 0, []byte{byte(cmdWrite), 0, 0, 0}}
+		return [][]byte{cnReply(req, true, marshal(status))}
+	}}
+	s := &Slave{family: 0x41, master: &Master{1, New(k)}}
+
+	// the first write fills the first request
+	_, err := s.Tx().AllowSplit().Write(make([]byte, maxTxLen-msgHdrLen-cmdHdrLen)).Write([]byte{0xcc}).Run()
+	var se *StatusError
+	// reported as the second command of the Tx
+	assert(t, errors.As(err, &se) && se.Index == 1)
+	assert(t, errors.Is(err, ErrNoDevice))
+}
+
+func TestTxStatus(t *testing.T) {
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, _ := parseW1Msg(req[20:])
+		// the slave did not answer the reset before MATCH ROM
+		status := &msg{slaveCmd, 19, 4, nil, m.slave, 0, []byte{byte(cmdWrite), 0, 0, 0}}
+		return [][]byte{cnReply(req, true, marshal(status))}
+	}}
+	s := &Slave{family: 0x41, master: &Master{1, New(k)}}
+
+	_, err := s.Tx().Write([]byte{0xcc}).Read(1).Run()
+	assert(t, err != nil)
+}
@@ -19,18 +19,23 @@
 package w1
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
 
 	"github.com/lambdasoup/go-netlink/connector"
 	"github.com/lambdasoup/go-netlink/log"
+	"github.com/lambdasoup/go-netlink/netlink"
 )
 
 // W1 is a 1-Wire connection
 type W1 struct {
 	c *connector.Connector
+
+	// listen opens the Listener for hotplug broadcasts, connector.Listen
+	// if nil
+	listen func() (*connector.Listener, error)
+	// stops ends the event streams
+	stops []func()
 }
 
 // ListMasters returns a list of the current list masters
@@ -45,31 +50,66 @@ func (w1 *W1) ListMasters() (masters []Master, err error) {
 	}
 	// expecting only one response message
 	msg := msgs[0]
-	buf := bytes.NewBuffer(msg.data)
-	for i := 0; i < int(msg.len); i = i + 4 {
-		var id uint32
-		binary.Read(buf, binary.LittleEndian, &id)
-		masters = append(masters, Master{id, w1})
+	for i := 0; i+4 <= len(msg.data); i = i + 4 {
+		masters = append(masters, Master{netlink.NativeEndian.Uint32(msg.data[i:]), w1})
 	}
 	return
 }
 
 func (w1 *W1) request(req *msg, statusReplies int) (res []msg, err error) {
-	log.Printf("\tW1 REQUEST: %v", req)
+	return w1.exchange([]*msg{req}, statusReplies, 1)
+}
 
-	msgID, err := w1.c.Send(req.toBytes())
+// exchange sends reqs in one connector message and collects their replies
+// until the given number of status replies and at least minReplies replies
+// arrived. The kernel runs the messages one after the other.
+func (w1 *W1) exchange(reqs []*msg, statusReplies int, minReplies int) (res []msg, err error) {
+	ids, err := w1.sendAll([][]*msg{reqs})
 	if err != nil {
 		return
 	}
+	return w1.collect(ids[0], statusReplies, minReplies)
+}
+
+// sendAll sends each list of messages in a connector message of its own,
+// all of them at once. The kernel runs them in order.
+func (w1 *W1) sendAll(reqs [][]*msg) ([]*connector.MsgID, error) {
+	cms := make([]*connector.Message, len(reqs))
+	for i, msgs := range reqs {
+		var bs []byte
+		for _, req := range msgs {
+			log.Printf("\tW1 REQUEST: %v", req)
+			var err error
+			bs, err = req.AppendBinary(bs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		cms[i] = &connector.Message{Data: bs}
+	}
+	return w1.c.SendMessages(cms)
+}
+
+// collect receives the replies to the request of the given MsgID until the
+// given number of status replies and at least minReplies replies arrived
+func (w1 *W1) collect(msgID *connector.MsgID, statusReplies int, minReplies int) (res []msg, err error) {
 
 	// we need to await all status replies and the actual response
 	// these are all out-of-order
-	for statusReplies > 0 || res == nil {
+	for index := 0; statusReplies > 0 || len(res) < minReplies; {
 		data, rtype, err := w1.c.Receive(msgID)
 		if err != nil {
 			return nil, err
 		}
-		m := parseW1Msg(data)
+		if rtype == connector.ResponseTypeUnrelated {
+			// e.g. a broadcast, those are for a connector.Listener
+			log.Printf("\tW1 SKIP UNRELATED: %x", data)
+			continue
+		}
+		m, err := parseW1Msg(data)
+		if err != nil {
+			return nil, err
+		}
 		switch rtype {
 		case connector.ResponseTypeReply:
 			log.Printf("\tW1 RECV REPLY: %v", m)
@@ -77,13 +117,10 @@ func (w1 *W1) request(req *msg, statusReplies int) (res []msg, err error) {
 		case connector.ResponseTypeEcho:
 			log.Printf("\tW1 RECV STATUS: %v", m)
 			if m.status != 0 {
-				err = fmt.Errorf("status error %d", m.status)
-				return nil, err
+				return nil, newStatusError(&m, index)
 			}
 			statusReplies--
-		case connector.ResponseTypeUnrelated:
-			err = errors.New("received unexpected unrelated response")
-			return nil, err
+			index++
 		}
 	}
 
@@ -94,32 +131,42 @@ func (w1 *W1) request(req *msg, statusReplies int) (res []msg, err error) {
 func (w1 *W1) send(req *msg) (err error) {
 	log.Printf("\tW1 SEND: %v", req)
 
-	msgID, err := w1.c.Send(req.toBytes())
+	bs, err := req.MarshalBinary()
 	if err != nil {
 		return
 	}
-
-	data, rtype, err := w1.c.Receive(msgID)
+	msgID, err := w1.c.Send(bs)
 	if err != nil {
 		return
 	}
 
-	msg := parseW1Msg(data)
-	switch rtype {
-	case connector.ResponseTypeReply:
-		return errors.New("received unexpected request response")
-	case connector.ResponseTypeEcho:
-		log.Printf("\tW1 RECV STATUS: %v", msg)
-		if msg.status != 0 {
-			err = fmt.Errorf("status error %d", msg.status)
+	for {
+		data, rtype, err := w1.c.Receive(msgID)
+		if err != nil {
 			return err
 		}
-		return nil
-	case connector.ResponseTypeUnrelated:
-		return errors.New("received unexpected unrelated response")
-	}
 
-	panic(fmt.Sprintf("unexpected connector msg type %d", rtype))
+		if rtype == connector.ResponseTypeUnrelated {
+			log.Printf("\tW1 SKIP UNRELATED: %x", data)
+			continue
+		}
+		msg, err := parseW1Msg(data)
+		if err != nil {
+			return err
+		}
+		switch rtype {
+		case connector.ResponseTypeReply:
+			return errors.New("received unexpected request response")
+		case connector.ResponseTypeEcho:
+			log.Printf("\tW1 RECV STATUS: %v", msg)
+			if msg.status != 0 {
+				return newStatusError(&msg, 0)
+			}
+			return nil
+		default:
+			panic(fmt.Sprintf("unexpected connector msg type %v", rtype))
+		}
+	}
 }
 
 // Open a connection to the 1-Wire subsystem
@@ -129,7 +176,16 @@ func (w1 *W1) Open() (err error) {
 	return
 }
 
+// New returns a 1-Wire connection on top of the given transport
+func New(t netlink.Transport) *W1 {
+	return &W1{c: connector.New(t, connector.W1)}
+}
+
 // Close closes this 1-Wire connection
 func (w1 *W1) Close() {
+	for _, stop := range w1.stops {
+		stop()
+	}
+	w1.stops = nil
 	w1.c.Close()
 }
@@ -16,3 +16,114 @@
 // along with go-netlink.  If not, see <http://www.gnu.org/licenses/>.
 
 package w1
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/lambdasoup/go-netlink/internal/nltest"
+	"github.com/lambdasoup/go-netlink/netlink"
+)
+
+// fakeKernel is an in-memory netlink.Transport standing in for the
+// kernel's w1 connector
+type fakeKernel struct {
+	// handle returns the replies to the given connector request
+	handle func(req []byte) [][]byte
+	queue  [][]byte
+	sent   [][]byte
+}
+
+func (k *fakeKernel) Send(data []byte) error {
+	k.sent = append(k.sent, data)
+	k.queue = append(k.queue, k.handle(data)...)
+	return nil
+}
+
+func (k *fakeKernel) Receive() ([]byte, error) {
+	if len(k.queue) == 0 {
+		return nil, errors.New("fake kernel has nothing to send")
+	}
+	data := k.queue[0]
+	k.queue = k.queue[1:]
+	return data, nil
+}
+
+func (k *fakeKernel) Close() {}
+
+// cnReply wraps the given w1 message in a connector message answering req.
+// Replies carry ack = seq + 1, status messages echo the request's ack.
+func cnReply(req []byte, status bool, w1 []byte) []byte {
+	buf := new(bytes.Buffer)
+	// id and seq are echoed
+	buf.Write(req[:12])
+	seq := netlink.NativeEndian.Uint32(req[8:12])
+	if status {
+		buf.Write(req[12:16])
+	} else {
+		binary.Write(buf, netlink.NativeEndian, seq+1)
+	}
+	binary.Write(buf, netlink.NativeEndian, uint16(len(w1)))
+	binary.Write(buf, netlink.NativeEndian, uint16(0))
+	buf.Write(w1)
+	return buf.Bytes()
+}
+
+func TestListMasters(t *testing.T) {
+	nltest.UseByteOrder(t, binary.LittleEndian)
+
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		m, err := parseW1Msg(req[20:])
+		assert(t, err == nil)
+		assert(t, m.w1Type == listMasters)
+
+		reply := &msg{listMasters, 0, 8, nil, nil, 0, []byte{1, 0, 0, 0, 7, 0, 0, 0}}
+		return [][]byte{cnReply(req, false, marshal(reply))}
+	}}
+
+	ms, err := New(k).ListMasters()
+	if err != nil {
+		t.Fatalf("could not list masters: %v", err)
+	}
+
+	assert(t, len(ms) == 2)
+	assert(t, ms[0].id == 1)
+	assert(t, ms[1].id == 7)
+}
+
+func TestSkipUnrelated(t *testing.T) {
+	k := &fakeKernel{handle: func(req []byte) [][]byte {
+		// a slave add broadcast arriving before the reply
+		added := marshal(&msg{slaveAdd, 0, 0, nil, &Slave{family: 0x41}, 0, nil})
+		broadcast := cnReply(req, false, added)
+		netlink.NativeEndian.PutUint32(broadcast[8:], 4711)
+		netlink.NativeEndian.PutUint32(broadcast[12:], 0)
+
+		reply := &msg{listMasters, 0, 4, nil, nil, 0, []byte{1, 0, 0, 0}}
+		return [][]byte{broadcast, cnReply(req, false, marshal(reply))}
+	}}
+
+	masters, err := New(k).ListMasters()
+	if err != nil {
+		t.Fatalf("could not list masters: %v", err)
+	}
+	assert(t, len(masters) == 1)
+}
+
+// marshal returns the wire format of the given message or command
+func marshal(m encoding.BinaryMarshaler) []byte {
+	bs, err := m.MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	return bs
+}
+
+func assert(t *testing.T, assertion bool) {
+	if !assertion {
+		t.Fatalf("assertion failed")
+	}
+}